@@ -0,0 +1,290 @@
+package db
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	envs "github.com/Gamma169/go-server-helpers/environments"
+	"github.com/Gamma169/go-server-helpers/logging"
+	"github.com/go-redis/redis/v8"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*********************************************
+ * Config Structs
+ *
+ * The env vars read by InitPostgres and InitRedis, for use with environments.Load
+ * Embed them in your own config struct to check every variable the service needs at once
+ * *******************************************/
+
+// Either URL, or Name, Host and User are required-- URL can't be set with Name, Host, User, Password, Port or SSLMode
+// The settings below SSLMode are added to the connection string with either URL or the other fields
+type PostgresConfig struct {
+	URL      string `env:"DATABASE_URL" secret:"true"`
+	Name     string `env:"DATABASE_NAME"`
+	Host     string `env:"DATABASE_HOST"`
+	User     string `env:"DATABASE_USER"`
+	Password string `env:"DATABASE_PASSWORD" secret:"true"`
+	Port     int    `env:"DATABASE_PORT" default:"5432"`
+	// One of disable, require, verify-ca or verify-full
+	SSLMode string `env:"SSL_MODE" default:"disable"`
+
+	// Paths to the certificate files-- SSLCert and SSLKey must be set together
+	SSLRootCert string `env:"DATABASE_SSL_ROOT_CERT"`
+	SSLCert     string `env:"DATABASE_SSL_CERT"`
+	SSLKey      string `env:"DATABASE_SSL_KEY"`
+	// Rounded up to whole seconds-- 0 waits forever
+	ConnectTimeout time.Duration `env:"DATABASE_CONNECT_TIMEOUT"`
+	// One of any, read-write, read-only, primary or standby-- checked by OpenPostgres after connecting
+	TargetSessionAttrs string `env:"DATABASE_TARGET_SESSION_ATTRS"`
+
+	// Shows up in pg_stat_activity
+	ApplicationName string `env:"DATABASE_APPLICATION_NAME"`
+	// Comma separated schemas (ex: "myschema,public")
+	SearchPath string `env:"DATABASE_SEARCH_PATH"`
+	// Postgres cancels statements that run longer than this-- 0 uses the server's setting
+	StatementTimeout time.Duration `env:"DATABASE_STATEMENT_TIMEOUT"`
+
+	Pool PoolOptions
+	// Not loaded from env-- used by OpenPostgres (defaults to logging.Default())
+	Logger logging.Logger
+}
+
+// The limits of a *sql.DB connection pool-- 0 leaves the database/sql default
+// The database/sql defaults are unlimited open connections kept forever, so set at least MaxOpenConns in production
+// (ex: max_connections on the server divided by the number of instances of the service)
+type PoolOptions struct {
+	MaxOpenConns    int           `env:"DATABASE_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `env:"DATABASE_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `env:"DATABASE_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `env:"DATABASE_CONN_MAX_IDLE_TIME"`
+}
+
+// Used by OpenPostgres-- call it on connections opened some other way
+func (o PoolOptions) Apply(dbConn *sql.DB) {
+	if o.MaxOpenConns != 0 {
+		dbConn.SetMaxOpenConns(o.MaxOpenConns)
+	}
+	if o.MaxIdleConns != 0 {
+		dbConn.SetMaxIdleConns(o.MaxIdleConns)
+	}
+	if o.ConnMaxLifetime != 0 {
+		dbConn.SetConnMaxLifetime(o.ConnMaxLifetime)
+	}
+	if o.ConnMaxIdleTime != 0 {
+		dbConn.SetConnMaxIdleTime(o.ConnMaxIdleTime)
+	}
+}
+
+// Loads the config with the prefix and checks that enough is set to connect
+func LoadPostgresConfig(envVarPrefix string) (PostgresConfig, error) {
+	return LoadPostgresConfigFromEnv(envs.Default(), envVarPrefix)
+}
+
+func LoadPostgresConfigFromEnv(env *envs.Env, envVarPrefix string) (cfg PostgresConfig, err error) {
+	if err = env.Load(&cfg, envVarPrefix); err != nil {
+		return
+	}
+	err = cfg.validate(envVarPrefix, func(envVar string) bool {
+		origin, read := env.OriginOf(envVar)
+		return read && origin != envs.OriginDefault
+	})
+	return
+}
+
+// isSet tells if a variable with a default (DATABASE_PORT or SSL_MODE) was set, since the field always has a value
+// It is nil if the config was not loaded from env vars-- then only the fields without a default are checked against URL
+func (cfg PostgresConfig) validate(envVarPrefix string, isSet func(envVar string) bool) error {
+	var errs envs.LoadErrors
+	if cfg.URL != "" {
+		conflicts := []string{}
+		discrete := []struct {
+			envVar string
+			set    bool
+		}{
+			{"DATABASE_NAME", cfg.Name != ""},
+			{"DATABASE_HOST", cfg.Host != ""},
+			{"DATABASE_USER", cfg.User != ""},
+			{"DATABASE_PASSWORD", cfg.Password != ""},
+			{"DATABASE_PORT", isSet != nil && isSet(envVarPrefix+"DATABASE_PORT")},
+			{"SSL_MODE", isSet != nil && isSet(envVarPrefix+"SSL_MODE")},
+		}
+		for _, d := range discrete {
+			if d.set {
+				conflicts = append(conflicts, envVarPrefix+d.envVar)
+			}
+		}
+		if len(conflicts) > 0 {
+			errs = append(errs, fmt.Errorf("%sDATABASE_URL can't be set with %s", envVarPrefix, strings.Join(conflicts, ", ")))
+		}
+	} else {
+		required := []struct{ envVar, val string }{{"DATABASE_NAME", cfg.Name}, {"DATABASE_HOST", cfg.Host}, {"DATABASE_USER", cfg.User}}
+		for _, r := range required {
+			if r.val == "" {
+				errs = append(errs, &envs.EnvError{Var: envVarPrefix + r.envVar, Err: envs.ErrNotSet})
+			}
+		}
+		if !oneOf(cfg.SSLMode, []string{"disable", "require", "verify-ca", "verify-full"}) {
+			errs = append(errs, &envs.EnvError{Var: envVarPrefix + "SSL_MODE", Value: cfg.SSLMode, Err: errors.New("must be one of disable, require, verify-ca, verify-full")})
+		} else if cfg.SSLMode == "disable" && (cfg.SSLRootCert != "" || cfg.SSLCert != "") {
+			errs = append(errs, fmt.Errorf("%sDATABASE_SSL_ROOT_CERT and %sDATABASE_SSL_CERT can't be used with %sSSL_MODE=disable", envVarPrefix, envVarPrefix, envVarPrefix))
+		}
+	}
+
+	if (cfg.SSLCert == "") != (cfg.SSLKey == "") {
+		errs = append(errs, fmt.Errorf("%sDATABASE_SSL_CERT and %sDATABASE_SSL_KEY must be set together", envVarPrefix, envVarPrefix))
+	}
+	if cfg.ConnectTimeout < 0 {
+		errs = append(errs, &envs.EnvError{Var: envVarPrefix + "DATABASE_CONNECT_TIMEOUT", Value: cfg.ConnectTimeout.String(), Err: errors.New("can't be negative")})
+	}
+	if cfg.TargetSessionAttrs != "" && !oneOf(cfg.TargetSessionAttrs, targetSessionAttrs) {
+		errs = append(errs, &envs.EnvError{Var: envVarPrefix + "DATABASE_TARGET_SESSION_ATTRS", Value: cfg.TargetSessionAttrs, Err: errors.New("must be one of " + strings.Join(targetSessionAttrs, ", "))})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func oneOf(val string, allowed []string) bool {
+	for _, a := range allowed {
+		if val == a {
+			return true
+		}
+	}
+	return false
+}
+
+// The connection string to pass to sql.Open
+// Does not include TargetSessionAttrs, which lib/pq doesn't support (use OpenPostgres to check it)
+func (cfg PostgresConfig) ConnString() string {
+	params := cfg.params()
+	if cfg.URL != "" {
+		return withURLParams(cfg.URL, params)
+	}
+	dsn := &DSNBuilder{}
+	dsn.Add("user", cfg.User).
+		Add("password", cfg.Password).
+		Add("dbname", cfg.Name).
+		Add("host", cfg.Host).
+		Add("port", strconv.Itoa(cfg.Port)).
+		Add("sslmode", cfg.SSLMode)
+	return withKeywordParams(dsn, params)
+}
+
+// The settings that are added to either the url or the other fields
+// lib/pq sends the ones it doesn't know about (ex: search_path) to postgres as settings for the session
+func (cfg PostgresConfig) params() [][2]string {
+	params := [][2]string{}
+	add := func(key string, value string) {
+		if value != "" {
+			params = append(params, [2]string{key, value})
+		}
+	}
+	add("sslrootcert", cfg.SSLRootCert)
+	add("sslcert", cfg.SSLCert)
+	add("sslkey", cfg.SSLKey)
+	if cfg.ConnectTimeout > 0 {
+		add("connect_timeout", strconv.FormatInt(int64((cfg.ConnectTimeout+time.Second-1)/time.Second), 10))
+	}
+	add("application_name", cfg.ApplicationName)
+	add("search_path", cfg.SearchPath)
+	if cfg.StatementTimeout != 0 {
+		add("statement_timeout", strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10))
+	}
+	return params
+}
+
+// Adds the params to the query of a postgres:// url, replacing any that are already there
+// The url can also be a "key=value" connection string
+func withURLParams(connURL string, params [][2]string) string {
+	if len(params) == 0 {
+		return connURL
+	}
+	u, err := url.Parse(connURL)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return withKeywordParams(&DSNBuilder{pairs: []string{connURL}}, params)
+	}
+	query := u.Query()
+	for _, p := range params {
+		query.Set(p[0], p[1])
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func withKeywordParams(dsn *DSNBuilder, params [][2]string) string {
+	for _, p := range params {
+		dsn.Add(p[0], p[1])
+	}
+	return dsn.String()
+}
+
+// Either URL or Host is required
+// Loaded with "REDIS_" (or "REDIS_TLS_" for TLS) added to the prefix
+type RedisConfig struct {
+	URL      string `env:"URL" secret:"true"`
+	Host     string `env:"HOST"`
+	Port     int    `env:"PORT" default:"6379"`
+	User     string `env:"USER"`
+	Password string `env:"PASSWORD" secret:"true"`
+	// Not loaded with the prefix-- InitRedis sets it from USE_TLS_CONFIG
+	UseTLSConfig bool
+	// Not loaded from env-- used by OpenRedis (defaults to logging.Default())
+	Logger logging.Logger
+}
+
+func LoadRedisConfig(envVarPrefix string, useTLS bool) (RedisConfig, error) {
+	return LoadRedisConfigFromEnv(envs.Default(), envVarPrefix, useTLS)
+}
+
+func LoadRedisConfigFromEnv(env *envs.Env, envVarPrefix string, useTLS bool) (cfg RedisConfig, err error) {
+	prefix := envVarPrefix + "REDIS_"
+	if useTLS {
+		prefix = envVarPrefix + "REDIS_TLS_"
+	}
+	if err = env.Load(&cfg, prefix); err != nil {
+		return
+	}
+	err = cfg.validate(prefix)
+	return
+}
+
+func (cfg RedisConfig) validate(prefix string) error {
+	if cfg.URL == "" && cfg.Host == "" {
+		return envs.LoadErrors{&envs.EnvError{Var: prefix + "HOST", Err: envs.ErrNotSet}}
+	}
+	return nil
+}
+
+// The options to pass to redis.NewClient
+func (cfg RedisConfig) Options() (*redis.Options, error) {
+	if cfg.URL != "" {
+		options, err := redis.ParseURL(cfg.URL)
+		if err != nil {
+			// The url can have a password, so don't include the parse error, which repeats it
+			return nil, errors.New("invalid redis url")
+		}
+		return cfg.withTLSConfig(options), nil
+	}
+	return cfg.withTLSConfig(&redis.Options{
+		Addr:     cfg.Host + ":" + strconv.Itoa(cfg.Port),
+		Password: cfg.Password,
+		Username: cfg.User,
+	}), nil
+}
+
+// TODO- possible need for heroku
+func (cfg RedisConfig) withTLSConfig(options *redis.Options) *redis.Options {
+	if cfg.UseTLSConfig {
+		options.TLSConfig = &tls.Config{
+			InsecureSkipVerify: true,
+		}
+	}
+	return options
+}
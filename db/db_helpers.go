@@ -1,29 +1,40 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"github.com/Gamma169/go-server-helpers/logging"
+	"github.com/Gamma169/go-server-helpers/retry"
 	"reflect"
 	"strings"
 	"time"
 )
 
-func CheckAndRetry(checkerFunc func() error, maxTries int, secondsToWait int, debug bool) (err error) {
-	for tries := 0; tries == 0 || err != nil; tries++ {
-		err = checkerFunc()
+// Calls checkerFunc up to maxTries more times after the first failure, waiting secondsToWait between each
+// Use the retry package directly for backoff, jitter and cancellation
+func CheckAndRetry(checkerFunc func() error, maxTries int, secondsToWait int, debug bool) error {
+	policy := fixedPolicy(maxTries, secondsToWait, debug, "Check failed")
+	return retry.Do(context.Background(), policy, func(context.Context) error {
+		return checkerFunc()
+	})
+}
 
-		if err != nil {
-			if tries > maxTries-1 {
-				return err
-			}
+// The policy used by the functions that take maxTries and secondsToWait
+func fixedPolicy(maxTries int, secondsToWait int, debug bool, failMsg string) retry.Policy {
+	if maxTries < 0 {
+		maxTries = 0
+	}
+	return retry.Policy{
+		MaxAttempts:  maxTries + 1,
+		InitialDelay: time.Duration(secondsToWait) * time.Second,
+		Multiplier:   1,
+		OnRetry: func(attempt int, err error, delay time.Duration) {
 			if debug {
-				log.Println(fmt.Sprintf("Error: Could not connect to DB -- trying again in %d seconds", secondsToWait))
+				logging.Default().Warn(fmt.Sprintf("%s -- trying again in %s", failMsg, delay), logging.Fields{logging.FieldError: err})
 			}
-			time.Sleep(time.Duration(secondsToWait) * time.Second)
-		}
+		},
 	}
-	return
 }
 
 // Generally this function isn't necessary because we use prepared statements, but more safety is good
@@ -45,11 +56,49 @@ func CheckStructFieldsForInjection(st interface{}) error {
 // A function that splits a string based on a delimiter and assigns it to a slice in a struct's field
 // Ex: a struct 's' with field 'MyArr', and string "val1::val2::val3"
 //     This function will assign ["val1", "val2", "val3"] into s.MyArr
+// The elements are converted to the element type of the field (ex: []int, []uuid.UUID, or a named slice type)
 func AssignArrayPropertyFromString(st interface{}, field string, arrString string, delimiter string) error {
+	fieldSt, err := arrayField(st, field)
+	if err != nil {
+		return err
+	}
+
+	elems := []*string{}
+	if arrString != "" {
+		for _, elem := range strings.Split(arrString, delimiter) {
+			elem := elem
+			elems = append(elems, &elem)
+		}
+	}
+	if err := setArrayFromStrings(fieldSt, elems); err != nil {
+		return fmt.Errorf("cannot assign %s: %w", field, err)
+	}
+	return nil
+}
+
+// Same as AssignArrayPropertyFromString for a postgres array literal (ex: {a,"b,c",NULL})
+// NULL elements need a field with pointer elements (ex: []*string) or sql.Scanner elements (ex: []sql.NullString)
+func AssignArrayPropertyFromPostgresArray(st interface{}, field string, literal string) error {
+	fieldSt, err := arrayField(st, field)
+	if err != nil {
+		return err
+	}
+
+	elems, err := ParsePostgresArray(literal)
+	if err != nil {
+		return err
+	}
+	if err := setArrayFromStrings(fieldSt, elems); err != nil {
+		return fmt.Errorf("cannot assign %s: %w", field, err)
+	}
+	return nil
+}
+
+func arrayField(st interface{}, field string) (reflect.Value, error) {
 	// st must be a pointer to a struct
 	refSt := reflect.ValueOf(st)
 	if refSt.Kind() != reflect.Ptr || refSt.Elem().Kind() != reflect.Struct {
-		return errors.New("st must be pointer to struct")
+		return reflect.Value{}, errors.New("st must be pointer to struct")
 	}
 
 	// Dereference pointer
@@ -58,24 +107,17 @@ func AssignArrayPropertyFromString(st interface{}, field string, arrString strin
 	// Lookup field by name
 	fieldSt := refSt.FieldByName(field)
 	if !fieldSt.IsValid() {
-		return fmt.Errorf("not a field name: %s", field)
+		return reflect.Value{}, fmt.Errorf("not a field name: %s", field)
 	}
 
 	// Field must be exported
 	if !fieldSt.CanSet() {
-		return fmt.Errorf("cannot set field %s", field)
+		return reflect.Value{}, fmt.Errorf("cannot set field %s", field)
 	}
 
 	// We expect an array field
 	if fieldSt.Kind() != reflect.Slice && fieldSt.Kind() != reflect.Array {
-		return fmt.Errorf("%s is not a slice or array field", field)
-	}
-
-	arr := []string{}
-	if arrString != "" {
-		arr = strings.Split(arrString, delimiter)
+		return reflect.Value{}, fmt.Errorf("%s is not a slice or array field", field)
 	}
-
-	fieldSt.Set(reflect.ValueOf(arr))
-	return nil
+	return fieldSt, nil
 }
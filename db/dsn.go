@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*********************************************
+ * DSN Builder
+ *
+ * Builds a libpq "key=value" connection string
+ * https://www.postgresql.org/docs/current/libpq-connect.html#LIBPQ-CONNSTRING
+ * *******************************************/
+
+type DSNBuilder struct {
+	pairs []string
+}
+
+// Adds the key with the value quoted and escaped-- the value can have any characters (ex: a password with ' or \)
+func (b *DSNBuilder) Add(key string, value string) *DSNBuilder {
+	b.pairs = append(b.pairs, key+"="+QuoteDSNValue(value))
+	return b
+}
+
+// Only adds the key if the value is not empty
+func (b *DSNBuilder) AddIfSet(key string, value string) *DSNBuilder {
+	if value != "" {
+		b.Add(key, value)
+	}
+	return b
+}
+
+func (b *DSNBuilder) String() string {
+	return strings.Join(b.pairs, " ")
+}
+
+var dsnValueEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// Values are always quoted, so empty values and values with spaces are fine too
+func QuoteDSNValue(value string) string {
+	return "'" + dsnValueEscaper.Replace(value) + "'"
+}
+
+/*********************************************
+ * Target Session Attrs
+ *
+ * lib/pq doesn't support target_session_attrs, so the connector checks it after connecting
+ * A connection to a server with the wrong role is closed and returns an error (it's retried by OpenPostgres)
+ * *******************************************/
+
+var targetSessionAttrs = []string{"any", "read-write", "read-only", "primary", "standby"}
+
+func newSessionAttrsConnector(connector driver.Connector, attrs string) driver.Connector {
+	if attrs == "" || attrs == "any" {
+		return connector
+	}
+	return &sessionAttrsConnector{connector, attrs}
+}
+
+type sessionAttrsConnector struct {
+	driver.Connector
+	attrs string
+}
+
+func (c *sessionAttrsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSessionAttrs(ctx, conn, c.attrs); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func checkSessionAttrs(ctx context.Context, conn driver.Conn, attrs string) error {
+	query, want := "SHOW transaction_read_only", "off"
+	switch attrs {
+	case "read-only":
+		want = "on"
+	case "primary":
+		query, want = "SELECT pg_is_in_recovery()", "false"
+	case "standby":
+		query, want = "SELECT pg_is_in_recovery()", "true"
+	}
+
+	queryer, ok := conn.(driver.QueryerContext)
+	if !ok {
+		return errors.New("driver can't check target_session_attrs")
+	}
+	rows, err := queryer.QueryContext(ctx, query, nil)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, 1)
+	if err := rows.Next(dest); err != nil && err != io.EOF {
+		return err
+	}
+	got := fmt.Sprint(dest[0])
+	if b, ok := dest[0].([]byte); ok {
+		got = string(b)
+	}
+	if got != want {
+		return fmt.Errorf("server does not match target_session_attrs=%s", attrs)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"database/sql"
+	"github.com/Gamma169/go-server-helpers/metrics"
+	"github.com/go-redis/redis/v8"
+)
+
+// Exposes the connection pool stats of a *sql.DB (ex: from InitPostgres) labeled with {db="<name>"}
+// The stats are read when the metrics are scraped
+func RegisterPostgresPoolMetrics(registry *metrics.Registry, name string, dbConn *sql.DB) {
+	labels := metrics.Labels{"db": name}
+	stat := func(fn func(sql.DBStats) float64) func() float64 {
+		return func() float64 { return fn(dbConn.Stats()) }
+	}
+
+	registry.RegisterGaugeFunc("db_pool_max_open_connections", "Maximum number of open connections to the database.", labels,
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	registry.RegisterGaugeFunc("db_pool_open_connections", "Number of established connections, both in use and idle.", labels,
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	registry.RegisterGaugeFunc("db_pool_in_use_connections", "Number of connections currently in use.", labels,
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	registry.RegisterGaugeFunc("db_pool_idle_connections", "Number of idle connections.", labels,
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	registry.RegisterCounterFunc("db_pool_wait_count_total", "Total number of connections waited for.", labels,
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	registry.RegisterCounterFunc("db_pool_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", labels,
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	registry.RegisterCounterFunc("db_pool_max_idle_closed_total", "Total number of connections closed due to SetMaxIdleConns.", labels,
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	registry.RegisterCounterFunc("db_pool_max_idle_time_closed_total", "Total number of connections closed due to SetConnMaxIdleTime.", labels,
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }))
+	registry.RegisterCounterFunc("db_pool_max_lifetime_closed_total", "Total number of connections closed due to SetConnMaxLifetime.", labels,
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
+
+// Exposes the connection pool stats of a redis client (ex: from InitRedis) labeled with {db="<name>"}
+func RegisterRedisPoolMetrics(registry *metrics.Registry, name string, redisClient *redis.Client) {
+	labels := metrics.Labels{"db": name}
+	stat := func(fn func(*redis.PoolStats) float64) func() float64 {
+		return func() float64 { return fn(redisClient.PoolStats()) }
+	}
+
+	registry.RegisterGaugeFunc("redis_pool_total_connections", "Number of connections in the pool.", labels,
+		stat(func(s *redis.PoolStats) float64 { return float64(s.TotalConns) }))
+	registry.RegisterGaugeFunc("redis_pool_idle_connections", "Number of idle connections in the pool.", labels,
+		stat(func(s *redis.PoolStats) float64 { return float64(s.IdleConns) }))
+	registry.RegisterCounterFunc("redis_pool_hits_total", "Number of times a free connection was found in the pool.", labels,
+		stat(func(s *redis.PoolStats) float64 { return float64(s.Hits) }))
+	registry.RegisterCounterFunc("redis_pool_misses_total", "Number of times a free connection was NOT found in the pool.", labels,
+		stat(func(s *redis.PoolStats) float64 { return float64(s.Misses) }))
+	registry.RegisterCounterFunc("redis_pool_timeouts_total", "Number of times a wait for a connection timed out.", labels,
+		stat(func(s *redis.PoolStats) float64 { return float64(s.Timeouts) }))
+	registry.RegisterCounterFunc("redis_pool_stale_connections_total", "Number of stale connections removed from the pool.", labels,
+		stat(func(s *redis.PoolStats) float64 { return float64(s.StaleConns) }))
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Gamma169/go-server-helpers/logging"
+	"github.com/Gamma169/go-server-helpers/retry"
+	"github.com/go-redis/redis/v8"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+/*********************************************
+ * Open
+ *
+ * Versions of InitPostgres and InitRedis that return errors instead of panicking
+ * Check the kind of failure with errors.Is(err, db.ErrUnreachable), etc
+ * *******************************************/
+
+var (
+	ErrMissingConfig = errors.New("missing or invalid config")
+	ErrUnreachable   = errors.New("database unreachable")
+	ErrAuth          = errors.New("database authentication failed")
+)
+
+// The error returned by the Open functions-- matches Kind with errors.Is, and unwraps to the underlying error
+type ConnError struct {
+	Kind error
+	Err  error
+}
+
+func (e *ConnError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, e.Err)
+}
+
+func (e *ConnError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ConnError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Same as the tries made by ValidateDBConnOrPanic
+func connectPolicy(logger logging.Logger) retry.Policy {
+	return retry.Policy{
+		MaxAttempts:  3,
+		InitialDelay: 3 * time.Second,
+		Multiplier:   1,
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			logger.Debug(fmt.Sprintf("Could not connect to database -- trying again in %s", delay), logging.Fields{logging.FieldError: err})
+		},
+	}
+}
+
+// Opens a connection pool and pings it, retrying a couple times if the database is not up yet
+// Gives up when ctx is done, and right away if the credentials are wrong
+func OpenPostgres(ctx context.Context, cfg PostgresConfig) (*sql.DB, error) {
+	if err := cfg.validate("", nil); err != nil {
+		return nil, &ConnError{ErrMissingConfig, err}
+	}
+	// Same as sql.Open("postgres", ...) but traces the queries
+	connector, err := pq.NewConnector(cfg.ConnString())
+	if err != nil {
+		return nil, &ConnError{ErrMissingConfig, err}
+	}
+	dbConn := sql.OpenDB(NewTracedConnector(newSessionAttrsConnector(connector, cfg.TargetSessionAttrs)))
+	cfg.Pool.Apply(dbConn)
+
+	if err := CheckDBConnectionWithPolicy(ctx, dbConn, connectPolicy(logging.OrDefault(cfg.Logger))); err != nil {
+		dbConn.Close()
+		return nil, connError(err, isPostgresAuthError)
+	}
+	return dbConn, nil
+}
+
+// Same as OpenPostgres for redis
+func OpenRedis(ctx context.Context, cfg RedisConfig) (*redis.Client, error) {
+	if err := cfg.validate(""); err != nil {
+		return nil, &ConnError{ErrMissingConfig, err}
+	}
+	redisOptions, err := cfg.Options()
+	if err != nil {
+		return nil, &ConnError{ErrMissingConfig, err}
+	}
+	redisClient := redis.NewClient(redisOptions)
+	redisClient.AddHook(NewRedisTracingHook())
+
+	if err := CheckRedisConnectionWithPolicy(ctx, redisClient, connectPolicy(logging.OrDefault(cfg.Logger))); err != nil {
+		redisClient.Close()
+		return nil, connError(err, isRedisAuthError)
+	}
+	return redisClient, nil
+}
+
+func connError(err error, isAuthError func(error) bool) error {
+	if isAuthError(err) {
+		return &ConnError{ErrAuth, err}
+	}
+	return &ConnError{ErrUnreachable, err}
+}
+
+// Class 28 is invalid authorization (ex: 28P01 wrong password)
+func isPostgresAuthError(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Class() == "28"
+}
+
+func isRedisAuthError(err error) bool {
+	msg := err.Error()
+	for _, prefix := range []string{"WRONGPASS", "NOAUTH", "NOPERM", "ERR AUTH"} {
+		if strings.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+/*********************************************
+ * Postgres Arrays
+ *
+ * Parses and formats array literals (ex: {a,"b,c",NULL}) for when an array is read or written as text
+ * Only one-dimensional arrays with ',' between the elements are supported (every type except box uses ',')
+ * https://www.postgresql.org/docs/current/arrays.html#ARRAYS-IO
+ * *******************************************/
+
+// Returns nil for NULL elements
+func ParsePostgresArray(literal string) ([]*string, error) {
+	literal = strings.TrimSpace(literal)
+	if len(literal) < 2 || literal[0] != '{' || literal[len(literal)-1] != '}' {
+		return nil, fmt.Errorf("array literal must be wrapped in {}: %q", literal)
+	}
+	inner := literal[1 : len(literal)-1]
+	elems := []*string{}
+	if strings.TrimSpace(inner) == "" {
+		return elems, nil
+	}
+
+	for i := 0; ; {
+		for i < len(inner) && isArraySpace(inner[i]) {
+			i++
+		}
+		if i < len(inner) && inner[i] == '{' {
+			return nil, errors.New("multi-dimensional arrays are not supported")
+		}
+
+		var elem strings.Builder
+		quoted := i < len(inner) && inner[i] == '"'
+		if quoted {
+			i++
+			for ; i < len(inner) && inner[i] != '"'; i++ {
+				if inner[i] == '\\' && i+1 < len(inner) {
+					i++
+				}
+				elem.WriteByte(inner[i])
+			}
+			if i >= len(inner) {
+				return nil, fmt.Errorf("unterminated quote in array literal: %q", literal)
+			}
+			i++
+			for i < len(inner) && isArraySpace(inner[i]) {
+				i++
+			}
+		} else {
+			for ; i < len(inner) && inner[i] != ','; i++ {
+				switch inner[i] {
+				case '"', '{', '}':
+					return nil, fmt.Errorf("unexpected %c in array literal: %q", inner[i], literal)
+				case '\\':
+					if i+1 < len(inner) {
+						i++
+					}
+				}
+				elem.WriteByte(inner[i])
+			}
+		}
+
+		val := elem.String()
+		if !quoted {
+			val = strings.TrimSpace(val)
+			if val == "" {
+				return nil, fmt.Errorf("empty element in array literal: %q", literal)
+			}
+		}
+		if !quoted && strings.EqualFold(val, "NULL") {
+			elems = append(elems, nil)
+		} else {
+			elems = append(elems, &val)
+		}
+
+		if i >= len(inner) {
+			return elems, nil
+		}
+		if inner[i] != ',' {
+			return nil, fmt.Errorf("expected , after element in array literal: %q", literal)
+		}
+		i++
+	}
+}
+
+func isArraySpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// Formats values as an array literal to write back to postgres (ex: []string{"a", "b,c"} => {a,"b,c"})
+// Elements can be any type that AssignArrayPropertyFromPostgresArray converts to
+// time.Time is written the way postgres writes timestamptz, and []byte in the bytea hex format (ex: \x0a1b)
+// nil pointers, nil []byte, and driver.Valuers that return nil (ex: an invalid sql.NullString) are written as NULL
+func FormatPostgresArray[T any](values []T) (string, error) {
+	elems := make([]string, len(values))
+	for i, value := range values {
+		elem, isNull, err := formatArrayElement(reflect.ValueOf(&value).Elem())
+		if err != nil {
+			return "", fmt.Errorf("element %d: %w", i, err)
+		}
+		if isNull {
+			elems[i] = "NULL"
+		} else {
+			elems[i] = quoteArrayElement(elem)
+		}
+	}
+	return "{" + strings.Join(elems, ",") + "}", nil
+}
+
+var (
+	valuerType        = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func formatArrayElement(v reflect.Value) (string, bool, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", true, nil
+		}
+		if v.Type().Implements(valuerType) || v.Type().Implements(textMarshalerType) {
+			break
+		}
+		v = v.Elem()
+	}
+
+	// Checked before TextMarshaler, which would write RFC 3339
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(pgTimestampFormat), false, nil
+	}
+	if v.Type().Implements(valuerType) {
+		value, err := v.Interface().(driver.Valuer).Value()
+		if err != nil {
+			return "", false, err
+		}
+		if value == nil {
+			return "", true, nil
+		}
+		return formatArrayElement(reflect.ValueOf(value))
+	}
+	if v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), false, err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), false, nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), false, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), false, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), false, nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), false, nil
+	case reflect.Slice:
+		if isByteSlice(v.Type()) {
+			if v.IsNil() {
+				return "", true, nil
+			}
+			return `\x` + hex.EncodeToString(v.Bytes()), false, nil
+		}
+	}
+	return "", false, fmt.Errorf("can't format %s as an array element", v.Type())
+}
+
+var arrayElementEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// Elements are only quoted when they have to be, like postgres does
+func quoteArrayElement(elem string) string {
+	needsQuotes := elem == "" || strings.EqualFold(elem, "NULL") || strings.IndexFunc(elem, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`{}",\`, r)
+	}) >= 0
+	if !needsQuotes {
+		return elem
+	}
+	return `"` + arrayElementEscaper.Replace(elem) + `"`
+}
+
+/*********************************************
+ * Element Conversion
+ * *******************************************/
+
+// Sets the slice or array v to elems converted to its element type
+func setArrayFromStrings(v reflect.Value, elems []*string) error {
+	arr := v
+	if v.Kind() == reflect.Slice {
+		arr = reflect.MakeSlice(v.Type(), len(elems), len(elems))
+	} else if v.Len() != len(elems) {
+		return fmt.Errorf("array has length %d, but got %d elements", v.Len(), len(elems))
+	}
+
+	for i, elem := range elems {
+		if err := setElementFromString(arr.Index(i), elem); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+	}
+	if v.Kind() == reflect.Slice {
+		v.Set(arr)
+	}
+	return nil
+}
+
+func setElementFromString(v reflect.Value, elem *string) error {
+	if elem == nil {
+		if v.Kind() == reflect.Ptr || isByteSlice(v.Type()) {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if scanner, ok := v.Addr().Interface().(sql.Scanner); ok {
+			return scanner.Scan(nil)
+		}
+		return fmt.Errorf("NULL can't be assigned to %s", v.Type())
+	}
+
+	if v.Kind() == reflect.Ptr {
+		ptr := reflect.New(v.Type().Elem())
+		if err := setElementFromString(ptr.Elem(), elem); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	}
+
+	val := *elem
+	// Checked before TextUnmarshaler, which only accepts RFC 3339
+	if v.Type() == timeType {
+		t, err := parsePostgresTimestamp(val)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch u := v.Addr().Interface().(type) {
+	case encoding.TextUnmarshaler:
+		return u.UnmarshalText([]byte(val))
+	case sql.Scanner:
+		return u.Scan(val)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		// Also accepts t and f, which is how postgres writes booleans
+		b, err := strconv.ParseBool(strings.TrimSpace(val))
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(val), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(strings.TrimSpace(val), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if !isByteSlice(v.Type()) {
+			return fmt.Errorf("can't convert elements to %s", v.Type())
+		}
+		if !strings.HasPrefix(val, `\x`) {
+			return errors.New(`bytea elements must be in the hex format (ex: \x0a1b)`)
+		}
+		b, err := hex.DecodeString(val[2:])
+		if err != nil {
+			return err
+		}
+		v.SetBytes(b)
+	default:
+		return fmt.Errorf("can't convert elements to %s", v.Type())
+	}
+	return nil
+}
+
+func isByteSlice(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
+// How postgres writes timestamptz (with the default DateStyle), except "Z" is used for UTC
+const pgTimestampFormat = "2006-01-02 15:04:05.999999999Z07:00"
+
+// Fractional seconds are allowed after the seconds even though the layouts don't have them
+var pgTimestampLayouts = []string{
+	"2006-01-02 15:04:05Z07:00:00",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05Z07",
+	// timestamp without time zone-- parsed as UTC
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Parses timestamps the way postgres writes them (ex: 2024-01-01 00:00:00+00), and also with a T like RFC 3339
+func parsePostgresTimestamp(val string) (time.Time, error) {
+	val = strings.TrimSpace(val)
+	if len(val) > 10 && val[10] == 'T' {
+		val = val[:10] + " " + val[11:]
+	}
+	for _, layout := range pgTimestampLayouts {
+		if t, err := time.Parse(layout, val); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("can't parse %q as a timestamp", val)
+}
@@ -1,62 +1,70 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	envs "github.com/Gamma169/go-server-helpers/environments"
-	_ "github.com/lib/pq"
-	"log"
+	"github.com/Gamma169/go-server-helpers/logging"
+	"github.com/Gamma169/go-server-helpers/retry"
 )
 
+// Panics with every missing or invalid variable (see PostgresConfig)
 func CheckRequiredPostgresEnvs(envVarPrefix string) {
-	// Not sure if I should use the getOptionalEnv function here or just os.LookupEnv
-	// Because if I use getOptionalEnv and it doesn't exist, we output the logs for it twice
-	// I think that's fine, but I need to think on it
-	if envs.GetOptionalEnv(envVarPrefix+"DATABASE_URL", "") == "" {
-		envs.GetRequiredEnv(envVarPrefix + "DATABASE_NAME")
-		envs.GetRequiredEnv(envVarPrefix + "DATABASE_HOST")
-		envs.GetRequiredEnv(envVarPrefix + "DATABASE_USER")
+	if _, err := LoadPostgresConfig(envVarPrefix); err != nil {
+		logging.Default().Error("Missing or invalid postgres env vars", logging.Fields{logging.FieldError: err})
+		panic(err)
 	}
 }
 
 func InitPostgres(envVarPrefix string, debug bool) (dbConn *sql.DB) {
+	return InitPostgresFromEnv(envs.Default(), envVarPrefix, debug)
+}
+
+// Same as InitPostgres but reads the config from env (ex: an Env with a MapSource in tests)
+func InitPostgresFromEnv(env *envs.Env, envVarPrefix string, debug bool) (dbConn *sql.DB) {
 	if debug {
-		log.Println("Establishing connection with postgres database")
-	}
-	var err error
-
-	if dbURL := envs.GetOptionalEnv(envVarPrefix+"DATABASE_URL", ""); dbURL != "" {
-		dbConn, err = sql.Open("postgres", dbURL)
-	} else {
-		dbConn, err = sql.Open("postgres",
-			fmt.Sprintf("user='%s' password='%s' dbname='%s' host='%s' port=%s sslmode=%s",
-				envs.GetRequiredEnv(envVarPrefix+"DATABASE_USER"),
-				envs.GetOptionalEnv(envVarPrefix+"DATABASE_PASSWORD", ""),
-				envs.GetRequiredEnv(envVarPrefix+"DATABASE_NAME"),
-				envs.GetRequiredEnv(envVarPrefix+"DATABASE_HOST"),
-				envs.GetOptionalEnv(envVarPrefix+"DATABASE_PORT", "5432"),
-				envs.GetOptionalEnv(envVarPrefix+"SSL_MODE", "disable")))
+		env.Logger().Debug("Establishing connection with postgres database")
 	}
 
+	cfg, err := LoadPostgresConfigFromEnv(env, envVarPrefix)
 	if err != nil {
-		log.Println("Error with sql Open statement")
+		env.Logger().Error("Missing or invalid postgres env vars", logging.Fields{logging.FieldError: err})
 		panic(err)
 	}
 
-	ValidateDBConnOrPanic(dbConn, debug)
+	cfg.Logger = env.Logger()
+	dbConn, err = OpenPostgres(context.Background(), cfg)
+	if err != nil {
+		env.Logger().Error("Error: Could not connect to DB", logging.Fields{logging.FieldError: err})
+		panic(err)
+	}
 	if debug {
-		log.Println("Connection sucessfully established")
+		env.Logger().Debug("Connection sucessfully established")
 	}
 	return
 }
 
 func CheckDBConnection(dbConn *sql.DB, maxTries int, secondsToWait int, debug bool) error {
-	return CheckAndRetry(dbConn.Ping, maxTries, secondsToWait, debug)
+	policy := fixedPolicy(maxTries, secondsToWait, debug, "Could not connect to postgres")
+	return CheckDBConnectionWithPolicy(context.Background(), dbConn, policy)
+}
+
+// Pings until the policy or ctx runs out-- wrong credentials are not retried unless policy.Retryable is set
+func CheckDBConnectionWithPolicy(ctx context.Context, dbConn *sql.DB, policy retry.Policy) error {
+	if policy.Retryable == nil {
+		policy.Retryable = func(err error) bool { return !isPostgresAuthError(err) }
+	}
+	return retry.Do(ctx, policy, dbConn.PingContext)
+}
+
+// For use with server.HealthRegistry
+func PostgresHealthCheck(dbConn *sql.DB) func(context.Context) error {
+	return dbConn.PingContext
 }
 
 func ValidateDBConnOrPanic(dbConn *sql.DB, debug bool) {
 	if err := CheckDBConnection(dbConn, 2, 3, debug); err != nil {
-		log.Println("Error: Could not connect to DB")
+		logging.Default().Error("Error: Could not connect to DB", logging.Fields{logging.FieldError: err})
 		panic(err)
 	}
 }
@@ -1,56 +1,73 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Gamma169/go-server-helpers/logging"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
-	"log"
 	"math/rand"
 	"time"
 )
 
 func InitPostgresMigrations(dbConn *sql.DB, maxMsToWait int, isRunningLocally bool, debug bool) {
+	if err := RunPostgresMigrations(context.Background(), dbConn, maxMsToWait, isRunningLocally, debug); err != nil {
+		logging.Default().Error("Error with Migrations", logging.Fields{logging.FieldError: err})
+		panic(err)
+	}
+}
+
+// Runs the migrations in ./migrations/ and returns an error instead of panicking
+// Having no new migrations to run is not an error
+// ctx only cancels the wait before the migrations-- once they start they run to the end
+func RunPostgresMigrations(ctx context.Context, dbConn *sql.DB, maxMsToWait int, isRunningLocally bool, debug bool) error {
 	if debug {
-		log.Println("Doing Migrations")
+		logging.Default().Debug("Doing Migrations")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	if !isRunningLocally {
+	if !isRunningLocally && maxMsToWait > 0 {
 		msToWait := rand.Intn(maxMsToWait)
 		if debug {
-			log.Println("Waiting this many mSec before running migrations: ", msToWait)
+			logging.Default().Debug(fmt.Sprintf("Waiting this many mSec before running migrations: %d", msToWait))
 		}
 		// If we have multiple services starting up at the same time
 		// we don't want the migrations to overlap
-		time.Sleep(time.Duration(msToWait) * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(msToWait) * time.Millisecond):
+		}
 	}
 
 	driver, err := postgres.WithInstance(dbConn, &postgres.Config{})
 	if err != nil {
-		log.Println("Error:  Couldn't create migrations driver")
-		panic(err)
+		return fmt.Errorf("couldn't create migrations driver: %w", err)
 	}
 
 	m, err := migrate.NewWithDatabaseInstance(
 		"file://./migrations/",
 		"postgres", driver)
 	if err != nil {
-		log.Println("Error:  Couldn't run migrations")
-		panic(err)
+		return fmt.Errorf("couldn't run migrations: %w", err)
 	}
 
 	if err := m.Up(); err != nil {
-		if err.Error() == "no change" {
-			if debug {
-				log.Println("no change")
-			}
-		} else {
-			log.Println("Error with Migrations")
-			panic(err)
+		if !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+		if debug {
+			logging.Default().Debug("no change")
 		}
 	}
 
 	if debug {
-		log.Println("Migrations Successful")
+		logging.Default().Debug("Migrations Successful")
 	}
+	return nil
 }
@@ -2,77 +2,78 @@ package db
 
 import (
 	"context"
-	"crypto/tls"
 	envs "github.com/Gamma169/go-server-helpers/environments"
+	"github.com/Gamma169/go-server-helpers/logging"
+	"github.com/Gamma169/go-server-helpers/retry"
 	"github.com/go-redis/redis/v8"
-	"log"
 )
 
+// Panics with every missing or invalid variable (see RedisConfig)
 func CheckRequiredRedisEnvs(envVarPrefix string, useTLS bool) {
-	envVar := "REDIS"
-	if useTLS {
-		envVar = "REDIS_TLS"
-	}
-
-	if redisURL := envs.GetOptionalEnv(envVarPrefix+envVar+"_URL", ""); redisURL == "" {
-		envs.GetRequiredEnv(envVarPrefix + envVar + "_HOST")
+	if _, err := LoadRedisConfig(envVarPrefix, useTLS); err != nil {
+		logging.Default().Error("Missing or invalid redis env vars", logging.Fields{logging.FieldError: err})
+		panic(err)
 	}
 }
 
 func InitRedis(envVarPrefix string, useTLS bool, debug bool) (redisClient *redis.Client) {
+	return InitRedisFromEnv(envs.Default(), envVarPrefix, useTLS, debug)
+}
+
+// Same as InitRedis but reads the config from env (ex: an Env with a MapSource in tests)
+func InitRedisFromEnv(env *envs.Env, envVarPrefix string, useTLS bool, debug bool) (redisClient *redis.Client) {
 	if debug {
-		log.Println("Establishing connection with database")
-	}
-	envVar := "REDIS"
-	if useTLS {
-		envVar = "REDIS_TLS"
+		env.Logger().Debug("Establishing connection with database")
 	}
 
-	var redisOptions *redis.Options
-	if redisURL := envs.GetOptionalEnv(envVarPrefix+envVar+"_URL", ""); redisURL != "" {
-		var err error
-		if redisOptions, err = redis.ParseURL(redisURL); err != nil {
-			log.Println("Error creating redis options")
-			panic(err)
-		}
-	} else {
-		redisURL := envs.GetRequiredEnv(envVarPrefix+envVar+"_HOST") + ":" + envs.GetOptionalEnv(envVarPrefix+envVar+"_PORT", "6379")
-		redisPassword := envs.GetOptionalEnv(envVarPrefix+envVar+"_PASSWORD", "")
-		redisUser := envs.GetOptionalEnv(envVarPrefix+envVar+"_USER", "")
-		redisOptions = &redis.Options{
-			Addr:     redisURL,
-			Password: redisPassword,
-			Username: redisUser,
-		}
+	cfg, err := LoadRedisConfigFromEnv(env, envVarPrefix, useTLS)
+	if err != nil {
+		env.Logger().Error("Missing or invalid redis env vars", logging.Fields{logging.FieldError: err})
+		panic(err)
 	}
-
-	// TODO- possible need for heroku
-	if envs.GetOptionalEnv("USE_TLS_CONFIG", "false") == "true" {
-		redisOptions.TLSConfig = &tls.Config{
-			InsecureSkipVerify: true,
-		}
+	cfg.UseTLSConfig, err = env.GetOptionalBoolEnv("USE_TLS_CONFIG", false)
+	if err != nil {
+		env.Logger().Error("Error reading redis TLS config", logging.Fields{logging.FieldError: err})
+		panic(err)
 	}
 
-	redisClient = redis.NewClient(redisOptions)
-
-	ValidateRedisConnOrPanic(redisClient, debug)
+	cfg.Logger = env.Logger()
+	redisClient, err = OpenRedis(context.Background(), cfg)
+	if err != nil {
+		env.Logger().Error("Error: Could not connect to Redis DB", logging.Fields{logging.FieldError: err})
+		panic(err)
+	}
 	if debug {
-		log.Println("Sucessfully established redis connection")
+		env.Logger().Debug("Sucessfully established redis connection")
 	}
 	return
 }
 
 func CheckRedisConnection(redisClient *redis.Client, maxTries int, secondsToWait int, debug bool) error {
-	wrapperFunc := func() error {
-		_, err := redisClient.Ping(context.Background()).Result()
-		return err
+	policy := fixedPolicy(maxTries, secondsToWait, debug, "Could not connect to redis")
+	return CheckRedisConnectionWithPolicy(context.Background(), redisClient, policy)
+}
+
+// Pings until the policy or ctx runs out-- wrong credentials are not retried unless policy.Retryable is set
+func CheckRedisConnectionWithPolicy(ctx context.Context, redisClient *redis.Client, policy retry.Policy) error {
+	if policy.Retryable == nil {
+		policy.Retryable = func(err error) bool { return !isRedisAuthError(err) }
+	}
+	return retry.Do(ctx, policy, func(ctx context.Context) error {
+		return redisClient.Ping(ctx).Err()
+	})
+}
+
+// For use with server.HealthRegistry
+func RedisHealthCheck(redisClient *redis.Client) func(context.Context) error {
+	return func(ctx context.Context) error {
+		return redisClient.Ping(ctx).Err()
 	}
-	return CheckAndRetry(wrapperFunc, maxTries, secondsToWait, debug)
 }
 
 func ValidateRedisConnOrPanic(redisClient *redis.Client, debug bool) {
 	if err := CheckRedisConnection(redisClient, 2, 3, debug); err != nil {
-		log.Println("Error: Could not connect to Redis DB")
+		logging.Default().Error("Error: Could not connect to Redis DB", logging.Fields{logging.FieldError: err})
 		panic(err)
 	}
 }
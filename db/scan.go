@@ -0,0 +1,233 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+/*********************************************
+ * Row Scanning
+ *
+ * Scans rows into structs instead of listing every field in rows.Scan
+ * Ex:
+ *   type User struct {
+ *       Id        string
+ *       Email     string         `db:"email_address"`
+ *       Nickname  sql.NullString
+ *       DeletedAt *time.Time
+ *       Audit                    // embedded-- its fields are mapped as if they were in User
+ *       Internal  string         `db:"-"`
+ *   }
+ *   rows, err := dbConn.QueryContext(ctx, "SELECT id, email_address, nickname, deleted_at, created_at FROM users")
+ *   users, err := db.ScanAll[User](rows)
+ *
+ * A column is mapped to the field with its name in the db tag, or else the field whose name in snake_case matches (ex: CreatedAt => created_at)
+ * Columns without a field are skipped, unless the Strict option is passed
+ * NULL can only be scanned into pointers and types like sql.NullString
+ * Embedded struct pointers are allocated when a row has one of their columns (their type has to be exported)
+ * *******************************************/
+
+type ScanOption int
+
+const (
+	// Returns an error if a column doesn't have a field instead of skipping it
+	Strict ScanOption = iota + 1
+)
+
+// Reads every row and closes rows
+func ScanAll[T any](rows *sql.Rows, opts ...ScanOption) ([]T, error) {
+	defer rows.Close()
+	targets, err := newScanTargets[T](rows, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []T{}
+	for rows.Next() {
+		var item T
+		if err := rows.Scan(targets.pointers(reflect.ValueOf(&item).Elem())...); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+var ErrMultipleRows = errors.New("expected one row but got more than one")
+
+// Reads the only row and closes rows-- returns sql.ErrNoRows if there are none, like sql.Row does, and ErrMultipleRows if there is more than one
+// Takes *sql.Rows instead of *sql.Row (from QueryRowContext) since the columns of a *sql.Row can't be read
+func ScanOne[T any](rows *sql.Rows, opts ...ScanOption) (T, error) {
+	defer rows.Close()
+	var item T
+	targets, err := newScanTargets[T](rows, opts)
+	if err != nil {
+		return item, err
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return item, err
+		}
+		return item, sql.ErrNoRows
+	}
+	if err := rows.Scan(targets.pointers(reflect.ValueOf(&item).Elem())...); err != nil {
+		return item, err
+	}
+	var zero T
+	if rows.Next() {
+		return zero, ErrMultipleRows
+	}
+	if err := rows.Err(); err != nil {
+		return zero, err
+	}
+	return item, rows.Close()
+}
+
+// The index path of the field for each column-- nil for columns that are skipped
+type scanTargets [][]int
+
+func newScanTargets[T any](rows *sql.Rows, opts []ScanOption) (scanTargets, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("can only scan into structs, not %s", t)
+	}
+	strict := false
+	for _, opt := range opts {
+		strict = strict || opt == Strict
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	fields := fieldsByColumn(t)
+	targets := make(scanTargets, len(columns))
+	for i, column := range columns {
+		index, found := fields[column]
+		if !found && strict {
+			return nil, fmt.Errorf("no field in %s for column %s", t, column)
+		}
+		targets[i] = index
+	}
+	return targets, nil
+}
+
+func (targets scanTargets) pointers(v reflect.Value) []interface{} {
+	pointers := make([]interface{}, len(targets))
+	for i, index := range targets {
+		if index == nil {
+			pointers[i] = new(interface{})
+			continue
+		}
+		pointers[i] = fieldByIndexAlloc(v, index).Addr().Interface()
+	}
+	return pointers
+}
+
+// Same as v.FieldByIndex but allocates embedded struct pointers instead of panicking
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, fieldIndex := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(fieldIndex)
+	}
+	return v
+}
+
+/*********************************************
+ * Field Mapping
+ * *******************************************/
+
+var fieldMappings sync.Map
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// Cached per type since the fields of a type don't change
+func fieldsByColumn(t reflect.Type) map[string][]int {
+	if fields, ok := fieldMappings.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+	fields := map[string][]int{}
+	addFields(fields, t, nil)
+	fieldMappings.Store(t, fields)
+	return fields
+}
+
+// Fields of t come before the fields of its embedded structs, so they win if the names are the same
+func addFields(fields map[string][]int, t reflect.Type, parentIndex []int) {
+	embedded := []reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("db")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" && isEmbeddedStruct(field.Type) {
+			embedded = append(embedded, field)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = toSnakeCase(field.Name)
+		}
+		if _, found := fields[name]; !found {
+			fields[name] = append(append([]int{}, parentIndex...), i)
+		}
+	}
+
+	for _, field := range embedded {
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			// Can't allocate a pointer to an unexported type
+			if field.PkgPath != "" {
+				continue
+			}
+			fieldType = fieldType.Elem()
+		}
+		addFields(fields, fieldType, append(append([]int{}, parentIndex...), field.Index...))
+	}
+}
+
+// Structs that are scanned as a whole (ex: sql.NullString, time.Time) are not embedded structs
+func isEmbeddedStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(scannerType)
+}
+
+// Ex: CreatedAt => created_at, UserID => user_id, HTTPServer => http_server
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			startsWord := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])))
+			if startsWord {
+				b.WriteRune('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,290 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/Gamma169/go-server-helpers/tracing"
+	"github.com/go-redis/redis/v8"
+	"strings"
+)
+
+/*********************************************
+ * Postgres Tracing
+ *
+ * Wraps the driver so every query made with a context that has a span (ex: r.Context() with server.AddTracingMiddleware)
+ * gets a child span-- queries without a span in the context (ex: pings at startup) are not traced
+ * *******************************************/
+
+// Used by InitPostgres-- use it with sql.OpenDB to trace connections made some other way
+func NewTracedConnector(connector driver.Connector) driver.Connector {
+	return &tracedConnector{connector}
+}
+
+type tracedConnector struct {
+	driver.Connector
+}
+
+func (c *tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return wrapConn(conn), nil
+}
+
+// database/sql checks which optional interfaces a conn implements, so the wrapper only has Ping and ResetSession
+// if the driver's conn does-- otherwise a conn that can't ping or reset would look like it did
+func wrapConn(conn driver.Conn) driver.Conn {
+	traced := &tracedConn{conn}
+	pinger, isPinger := conn.(driver.Pinger)
+	resetter, isResetter := conn.(driver.SessionResetter)
+	switch {
+	case isPinger && isResetter:
+		return struct {
+			*tracedConn
+			driver.Pinger
+			driver.SessionResetter
+		}{traced, pinger, resetter}
+	case isPinger:
+		return struct {
+			*tracedConn
+			driver.Pinger
+		}{traced, pinger}
+	case isResetter:
+		return struct {
+			*tracedConn
+			driver.SessionResetter
+		}{traced, resetter}
+	}
+	return traced
+}
+
+func startQuerySpan(ctx context.Context, query string) (context.Context, *tracing.Span) {
+	if tracing.SpanFromContext(ctx) == nil {
+		return ctx, nil
+	}
+	// Name the span by the operation (ex: SELECT) to keep the number of span names low
+	operation := "query"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	ctx, span := tracing.Default().Start(ctx, operation, tracing.SpanKindClient)
+	span.SetAttribute("db.system", "postgresql")
+	span.SetAttribute("db.operation", operation)
+	// Only the statement-- never the args, which could have sensitive values
+	span.SetAttribute("db.statement", query)
+	return ctx, span
+}
+
+func endQuerySpan(span *tracing.Span, err error) {
+	if span == nil {
+		return
+	}
+	// ErrSkip just means database/sql will try another way, which gets its own span
+	if err != nil && !errors.Is(err, driver.ErrSkip) {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// The IsValid and CheckNamedValue fallbacks do what database/sql does for conns without them
+type tracedConn struct {
+	driver.Conn
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	queryerCtx, hasQueryerCtx := c.Conn.(driver.QueryerContext)
+	queryer, hasQueryer := c.Conn.(driver.Queryer)
+	if !hasQueryerCtx && !hasQueryer {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startQuerySpan(ctx, query)
+	defer func() { endQuerySpan(span, err) }()
+	if hasQueryerCtx {
+		return queryerCtx.QueryContext(ctx, query, args)
+	}
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return queryer.Query(query, values)
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (result driver.Result, err error) {
+	execerCtx, hasExecerCtx := c.Conn.(driver.ExecerContext)
+	execer, hasExecer := c.Conn.(driver.Execer)
+	if !hasExecerCtx && !hasExecer {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startQuerySpan(ctx, query)
+	defer func() { endQuerySpan(span, err) }()
+	if hasExecerCtx {
+		return execerCtx.ExecContext(ctx, query, args)
+	}
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return execer.Exec(query, values)
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (stmt driver.Stmt, err error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tracedStmt{stmt, query}, nil
+}
+
+// Same checks as database/sql makes for drivers without BeginTx-- Begin can't honor the options
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		return nil, errors.New("sql: driver does not support non-default isolation level")
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("sql: driver does not support read-only transactions")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Conn.Begin()
+}
+
+func (c *tracedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// ErrSkip makes database/sql use its default conversion
+func (c *tracedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+type tracedStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (rows driver.Rows, err error) {
+	ctx, span := startQuerySpan(ctx, s.query)
+	defer func() { endQuerySpan(span, err) }()
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return queryer.QueryContext(ctx, args)
+	}
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Stmt.Query(values)
+}
+
+func (s *tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (result driver.Result, err error) {
+	ctx, span := startQuerySpan(ctx, s.query)
+	defer func() { endQuerySpan(span, err) }()
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return execer.ExecContext(ctx, args)
+	}
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Stmt.Exec(values)
+}
+
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("driver does not support named parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+/*********************************************
+ * Redis Tracing
+ *
+ * A go-redis hook that adds a child span for every command (or pipeline)
+ * made with a context that has a span
+ * *******************************************/
+
+// Added by InitRedis-- add it to other clients with client.AddHook(db.NewRedisTracingHook())
+func NewRedisTracingHook() redis.Hook {
+	return redisTracingHook{}
+}
+
+type redisTracingHook struct{}
+
+func startRedisSpan(ctx context.Context, name string) context.Context {
+	if tracing.SpanFromContext(ctx) == nil {
+		return ctx
+	}
+	ctx, span := tracing.Default().Start(ctx, name, tracing.SpanKindClient)
+	span.SetAttribute("db.system", "redis")
+	// Just the command name-- never the args, which could have sensitive values
+	span.SetAttribute("db.operation", name)
+	return ctx
+}
+
+// ctx is the one returned by startRedisSpan, so any span in it is the command's span
+func endRedisSpan(ctx context.Context, err error) {
+	span := tracing.SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	// redis.Nil just means the key doesn't exist
+	if err != nil && err != redis.Nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+func (redisTracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return startRedisSpan(ctx, cmd.Name()), nil
+}
+
+func (redisTracingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	endRedisSpan(ctx, cmd.Err())
+	return nil
+}
+
+func (redisTracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	ctx = startRedisSpan(ctx, "pipeline")
+	if span := tracing.SpanFromContext(ctx); span != nil {
+		span.SetAttribute("db.redis.num_cmds", len(cmds))
+	}
+	return ctx, nil
+}
+
+func (redisTracingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && cmd.Err() != redis.Nil {
+			err = cmd.Err()
+			break
+		}
+	}
+	endRedisSpan(ctx, err)
+	return nil
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Gamma169/go-server-helpers/logging"
+	"github.com/Gamma169/go-server-helpers/retry"
+	"github.com/lib/pq"
+	"sync/atomic"
+	"time"
+)
+
+/*********************************************
+ * Transactions
+ *
+ * Ex:
+ *   err := db.WithTx(ctx, dbConn, &db.TxOptions{Isolation: sql.LevelSerializable}, func(tx *sql.Tx) error {
+ *       if _, err := tx.ExecContext(ctx, "UPDATE accounts ..."); err != nil {
+ *           return err
+ *       }
+ *       return db.WithSavepoint(ctx, tx, func(tx *sql.Tx) error {
+ *           ...   // rolled back on its own if it returns an error
+ *       })
+ *   })
+ *
+ * fn is called again when the transaction is retried, so it should not have side effects outside of tx
+ * *******************************************/
+
+type TxOptions struct {
+	// sql.LevelDefault uses the server's default (read committed for postgres)
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// How to retry serialization failures and deadlocks-- nil uses DefaultTxRetryPolicy
+	// If Retryable is nil, IsRetryableTxError is used
+	Retry *retry.Policy
+}
+
+// A few quick retries-- transactions that conflict usually succeed on the next try
+func DefaultTxRetryPolicy() retry.Policy {
+	return retry.Policy{
+		MaxAttempts:  5,
+		InitialDelay: 10 * time.Millisecond,
+		MaxDelay:     time.Second,
+		Jitter:       retry.FullJitter,
+	}
+}
+
+// Serialization failures (40001) and deadlocks (40P01) go away if the transaction is run again
+func IsRetryableTxError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
+
+// Runs fn in a transaction that is committed if fn returns nil, and rolled back if it returns an error or panics
+// The whole transaction is retried on serialization failures and deadlocks (see TxOptions.Retry)
+// opts can be nil
+func WithTx(ctx context.Context, dbConn *sql.DB, opts *TxOptions, fn func(tx *sql.Tx) error) error {
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+	policy := DefaultTxRetryPolicy()
+	if opts.Retry != nil {
+		policy = *opts.Retry
+	}
+	if policy.Retryable == nil {
+		policy.Retryable = IsRetryableTxError
+	}
+	if policy.OnRetry == nil {
+		policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+			logging.FromContext(ctx).Debug(fmt.Sprintf("Transaction failed -- trying again in %s", delay), logging.Fields{logging.FieldError: err})
+		}
+	}
+
+	txOptions := &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+	return retry.Do(ctx, policy, func(ctx context.Context) error {
+		return runTx(ctx, dbConn, txOptions, fn)
+	})
+}
+
+func runTx(ctx context.Context, dbConn *sql.DB, txOptions *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	tx, err := dbConn.BeginTx(ctx, txOptions)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+			logging.FromContext(ctx).Warn("Could not roll back transaction", logging.Fields{logging.FieldError: rollbackErr})
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+var savepointCount uint64
+
+// Runs fn in a savepoint inside tx-- if fn returns an error or panics only the changes made in fn are rolled back
+// The error is still returned so the caller can decide whether to continue the transaction
+// Savepoints can be nested
+func WithSavepoint(ctx context.Context, tx *sql.Tx, fn func(tx *sql.Tx) error) error {
+	name := fmt.Sprintf("sp_%d", atomic.AddUint64(&savepointCount, 1))
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+			panic(r)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if _, rollbackErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rollbackErr != nil {
+			logging.FromContext(ctx).Warn("Could not roll back to savepoint", logging.Fields{logging.FieldError: rollbackErr})
+		}
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
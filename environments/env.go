@@ -0,0 +1,164 @@
+package environments
+
+import (
+	"github.com/Gamma169/go-server-helpers/logging"
+	"os"
+	"sync"
+)
+
+/*********************************************
+ * Sources
+ *
+ * Where an Env reads variables from
+ * Use a MapSource in tests so each one has its own config without touching the process environment
+ * Ex:
+ *   env := environments.NewEnv(environments.MapSource{"DATABASE_HOST": "localhost"})
+ *   host := env.GetRequiredEnv("DATABASE_HOST")
+ * *******************************************/
+
+type Source interface {
+	Lookup(name string) (string, bool)
+	// Shown in Report as where a value came from (ex: "env" or the path of a .env file)
+	Name() string
+}
+
+type osSource struct{}
+
+// The process environment
+func OSSource() Source {
+	return osSource{}
+}
+
+func (osSource) Lookup(name string) (string, bool) { return os.LookupEnv(name) }
+func (osSource) Name() string                      { return "env" }
+
+type MapSource map[string]string
+
+func (m MapSource) Lookup(name string) (string, bool) {
+	val, found := m[name]
+	return val, found
+}
+func (m MapSource) Name() string { return "map" }
+
+type chainSource []Source
+
+// Looks in each source in order and uses the first one that has the variable set (and not empty)
+func ChainSource(sources ...Source) Source {
+	return chainSource(sources)
+}
+
+func (c chainSource) Lookup(name string) (string, bool) {
+	for _, source := range c {
+		if val, found := source.Lookup(name); found && val != "" {
+			return val, true
+		}
+	}
+	return "", false
+}
+func (c chainSource) Name() string { return "chain" }
+
+// Chains are flattened so Report shows the source the value actually came from
+func flattenSources(sources []Source) []Source {
+	flat := []Source{}
+	for _, source := range sources {
+		if chain, ok := source.(chainSource); ok {
+			flat = append(flat, flattenSources(chain)...)
+		} else {
+			flat = append(flat, source)
+		}
+	}
+	return flat
+}
+
+/*********************************************
+ * Env
+ *
+ * All the getters, Load, and Report are methods of an Env
+ * The package-level functions use the default Env, which reads the process environment (and the files from LoadDotEnv)
+ * *******************************************/
+
+type Env struct {
+	mu      sync.RWMutex
+	sources []Source
+
+	sensitiveMu sync.RWMutex
+	sensitive   map[string]bool
+
+	reportMu sync.Mutex
+	report   map[string]ReportEntry
+
+	logger logging.Logger
+}
+
+// Each variable is read from the first source that has it (see lookup for how VAR_FILE fits in)
+func NewEnv(sources ...Source) *Env {
+	return &Env{
+		sources:   sources,
+		sensitive: map[string]bool{},
+		report:    map[string]ReportEntry{},
+	}
+}
+
+// Logs defaults and read errors with l instead of the default logger
+// Also used by the db functions that take an Env (ex: db.InitPostgresFromEnv)
+func (e *Env) SetLogger(l logging.Logger) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.logger = l
+}
+
+// Returns the logger set with SetLogger, or the default logger
+func (e *Env) Logger() logging.Logger {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return logging.OrDefault(e.logger)
+}
+
+// Adds a source with the lowest precedence (ex: a .env file)
+func (e *Env) AddSource(source Source) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sources = append(e.sources, source)
+}
+
+// All the getters read variables through here
+// For each source in order, VAR is used if it is set (and not empty), otherwise the contents of the file named by VAR_FILE
+// So with the default Env the precedence is:
+//  1. VAR in the process environment
+//  2. VAR_FILE in the process environment
+//  3. VAR in the .env files loaded with LoadDotEnv
+//  4. VAR_FILE in the .env files
+//  5. The default (for optional getters)
+//
+// Returns an error if VAR_FILE is set but the file can't be read
+func (e *Env) lookup(envVar string) (string, Origin, bool, error) {
+	e.mu.RLock()
+	sources := flattenSources(e.sources)
+	e.mu.RUnlock()
+
+	for _, source := range sources {
+		if val, found := source.Lookup(envVar); found && val != "" {
+			return val, Origin(source.Name()), true, nil
+		}
+		if path, found := source.Lookup(envVar + "_FILE"); found && path != "" {
+			return e.readSecretFile(envVar, path)
+		}
+	}
+	return "", "", false, nil
+}
+
+var defaultMu sync.RWMutex
+var defaultEnv = NewEnv(OSSource())
+
+func Default() *Env {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultEnv
+}
+
+// Replaces the Env used by the package-level functions
+func SetDefault(e *Env) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultEnv = e
+}
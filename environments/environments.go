@@ -1,23 +1,37 @@
 package environments
 
 import (
-	"log"
-	"os"
+	"errors"
+	"github.com/Gamma169/go-server-helpers/logging"
 )
 
-func GetRequiredEnv(envVar string) string {
-	val, found := os.LookupEnv(envVar)
-	if !found || val == "" {
+// Use GetRequiredStringEnv to get an error instead of a panic
+func (e *Env) GetRequiredEnv(envVar string) string {
+	val, err := e.GetRequiredStringEnv(envVar)
+	if errors.Is(err, ErrNotSet) {
 		panic("PLEASE SET " + envVar + " ENVIRONMENT VARIABLE")
 	}
+	if err != nil {
+		e.Logger().Error("Could not read env var", logging.Fields{logging.FieldError: err})
+		panic(err)
+	}
 	return val
 }
 
-func GetOptionalEnv(envVar string, defaultVal string) string {
-	val, found := os.LookupEnv(envVar)
-	if !found || val == "" {
-		log.Printf("Env var: '%s' not found or empty.  Setting to default value: '%s'", envVar, defaultVal)
-		return defaultVal
+// Panics if VAR_FILE is set but can't be read, rather than silently using the default
+func (e *Env) GetOptionalEnv(envVar string, defaultVal string) string {
+	val, err := e.GetOptionalStringEnv(envVar, defaultVal)
+	if err != nil {
+		e.Logger().Error("Could not read env var", logging.Fields{logging.FieldError: err})
+		panic(err)
 	}
 	return val
 }
+
+func GetRequiredEnv(envVar string) string {
+	return Default().GetRequiredEnv(envVar)
+}
+
+func GetOptionalEnv(envVar string, defaultVal string) string {
+	return Default().GetOptionalEnv(envVar, defaultVal)
+}
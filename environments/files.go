@@ -0,0 +1,257 @@
+package environments
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// The contents of the file named by VAR_FILE (ex: a docker or kubernetes secret mounted at /run/secrets/db)
+// Trailing newlines are removed since most editors (and `echo`) add one
+// Variables read from files are registered as sensitive, since files are how secrets are mounted
+func (e *Env) readSecretFile(envVar string, path string) (string, Origin, bool, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", OriginFile, false, &EnvError{Var: envVar + "_FILE", Err: err}
+	}
+	e.RegisterSensitive(envVar)
+	return strings.TrimRight(string(contents), "\r\n"), OriginFile, true, nil
+}
+
+/*********************************************
+ * .env Files
+ *
+ * Supports:
+ *   # comments (and inline comments after a space in unquoted values)
+ *   export KEY=value
+ *   KEY='single quoted-- no escapes or expansion'
+ *   KEY="double quoted with \n escapes and ${EXPANSION}, can span lines"
+ *   KEY=unquoted with $EXPANSION
+ * Expansion uses the sources of the Env first (the process environment for ParseDotEnv and FileSource) and then the variables defined before it
+ * *******************************************/
+
+type fileSource struct {
+	path string
+	vars map[string]string
+}
+
+// Reads a .env file-- the variables in it can be expanded from the process environment
+func FileSource(path string) (Source, error) {
+	return newFileSource(path, OSSource())
+}
+
+func newFileSource(path string, expandFrom Source) (Source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	vars, err := parseDotEnv(f, expandFrom)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return fileSource{path: path, vars: vars}, nil
+}
+
+func (f fileSource) Lookup(name string) (string, bool) {
+	val, found := f.vars[name]
+	return val, found
+}
+func (f fileSource) Name() string { return f.path }
+
+// Adds the files (defaults to ".env") as sources after the existing ones, so the real environment always has precedence
+// and the first file that sets a variable wins
+// When called without paths, a missing .env file is not an error
+func (e *Env) LoadDotEnv(paths ...string) error {
+	optional := len(paths) == 0
+	if optional {
+		paths = []string{".env"}
+	}
+
+	for _, path := range paths {
+		e.mu.RLock()
+		expandFrom := ChainSource(e.sources...)
+		e.mu.RUnlock()
+
+		source, err := newFileSource(path, expandFrom)
+		if err != nil {
+			if optional && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		e.AddSource(source)
+	}
+	return nil
+}
+
+func LoadDotEnv(paths ...string) error {
+	return Default().LoadDotEnv(paths...)
+}
+
+// Parses the contents of a .env file without loading it
+func ParseDotEnv(r io.Reader) (map[string]string, error) {
+	return parseDotEnv(r, OSSource())
+}
+
+func parseDotEnv(r io.Reader, expandFrom Source) (map[string]string, error) {
+	vars := map[string]string{}
+	lookup := func(name string) string {
+		if val, found := expandFrom.Lookup(name); found && val != "" {
+			return val
+		}
+		return vars[name]
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		key, rest, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || !isValidDotEnvKey(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNum)
+		}
+		rest = strings.TrimLeft(rest, " \t")
+
+		startLine := lineNum
+		var val string
+		switch {
+		case strings.HasPrefix(rest, `"`):
+			// Keep reading lines until the closing quote
+			for !hasClosingQuote(rest[1:]) {
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("line %d: unterminated double quote", startLine)
+				}
+				lineNum++
+				rest += "\n" + scanner.Text()
+			}
+			var err error
+			if val, rest, err = parseDoubleQuoted(rest[1:], lookup); err != nil {
+				return nil, fmt.Errorf("line %d: %w", startLine, err)
+			}
+		case strings.HasPrefix(rest, `'`):
+			end := strings.Index(rest[1:], `'`)
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated single quote", startLine)
+			}
+			val, rest = rest[1:end+1], rest[end+2:]
+		default:
+			if i := strings.Index(rest, " #"); i >= 0 {
+				rest = rest[:i]
+			}
+			val, rest = expand(strings.TrimSpace(rest), lookup), ""
+		}
+
+		if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, fmt.Errorf("line %d: unexpected characters after the closing quote", startLine)
+		}
+		vars[key] = val
+	}
+	return vars, scanner.Err()
+}
+
+func isValidDotEnvKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, c := range key {
+		isLetter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !isLetter && (i == 0 || !(c >= '0' && c <= '9' || c == '.')) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasClosingQuote(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+		} else if s[i] == '"' {
+			return true
+		}
+	}
+	return false
+}
+
+// s starts after the opening quote-- returns the value and whatever is after the closing quote
+func parseDoubleQuoted(s string, lookup func(string) string) (string, string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", "", errors.New("unterminated double quote")
+			}
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				// \" \\ \$ and anything else is the character itself
+				b.WriteByte(s[i])
+			}
+		case '$':
+			name, length := expansionName(s[i+1:])
+			if length == 0 {
+				b.WriteByte(c)
+				continue
+			}
+			b.WriteString(lookup(name))
+			i += length
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", errors.New("unterminated double quote")
+}
+
+func expand(s string, lookup func(string) string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			b.WriteByte(s[i])
+			continue
+		}
+		name, length := expansionName(s[i+1:])
+		if length == 0 {
+			b.WriteByte('$')
+			continue
+		}
+		b.WriteString(lookup(name))
+		i += length
+	}
+	return b.String()
+}
+
+// Returns the name of a $VAR or ${VAR} at the start of s and how many characters it takes up
+func expansionName(s string) (string, int) {
+	if strings.HasPrefix(s, "{") {
+		end := strings.Index(s, "}")
+		if end < 0 {
+			return "", 0
+		}
+		return s[1:end], end + 1
+	}
+	end := 0
+	for end < len(s) && (s[end] == '_' || (s[end] >= 'a' && s[end] <= 'z') || (s[end] >= 'A' && s[end] <= 'Z') || (end > 0 && s[end] >= '0' && s[end] <= '9')) {
+		end++
+	}
+	return s[:end], end
+}
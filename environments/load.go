@@ -0,0 +1,314 @@
+package environments
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*********************************************
+ * Config Loader
+ *
+ * Fill a config struct from env vars with struct tags instead of calling the getters one by one
+ * Ex:
+ *   type Config struct {
+ *       Port      int           `env:"PORT"       default:"8080"`
+ *       Debug     bool          `env:"DEBUG"`
+ *       Timeout   time.Duration `env:"TIMEOUT"    default:"30s"`
+ *       LogLevel  string        `env:"LOG_LEVEL"  default:"info" oneof:"debug info warn error"`
+ *       Origins   []string      `env:"ORIGINS"    sep:","`
+ *       APIKey    string        `env:"API_KEY"    required:"true" secret:"true"`
+ *       Postgres  db.PostgresConfig                 // no tag-- its fields are loaded with the same prefix
+ *       Cache     CacheConfig   `prefix:"CACHE_"` // its fields are loaded with "CACHE_" added to the prefix
+ *   }
+ *   var cfg Config
+ *   err := environments.Load(&cfg, "MYAPP_")   // reads MYAPP_PORT, MYAPP_CACHE_..., etc
+ *
+ * Tags:
+ *   env       - the name of the variable (added to the prefix)-- fields without it are skipped, unless they are structs
+ *   default   - used if the variable is not set or empty
+ *   required  - "true" to report an error if the variable is not set or empty (and there is no default)
+ *   secret    - "true" to mark the variable as sensitive (see RegisterSensitive) so its value is never logged or returned in errors
+ *   sep       - separator for slices (defaults to ",")
+ *   oneof     - space-separated allowed values for strings
+ *   prefix    - added to the prefix for the fields of a nested struct
+ *
+ * Supported types are strings, bools, ints, uints, floats, time.Duration, url.URL, slices and maps of those (maps are "k=v,k2=v2"),
+ * pointers to those, and any type that implements Unmarshaler or encoding.TextUnmarshaler (ex: uuid.UUID)
+ * Fields for variables that are not set and have no default are left as they are
+ * *******************************************/
+
+// Implement this to parse a custom type from the value of a variable
+type Unmarshaler interface {
+	UnmarshalEnv(value string) error
+}
+
+// Every missing or invalid variable found by Load
+type LoadErrors []error
+
+func (e LoadErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+// Returns true if any of the errors matches target (ex: errors.Is(err, ErrNotSet))
+func (e LoadErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+	urlType             = reflect.TypeOf(url.URL{})
+)
+
+// Fills cfg (a pointer to a struct) from the env vars named by its tags, each prefixed with prefix
+// Returns LoadErrors with every missing or invalid variable-- not just the first one
+// Panics if cfg is not a pointer to a struct or a field has an unsupported type, since those are programming errors
+func (e *Env) Load(cfg interface{}, prefix string) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("environments.Load expects a pointer to a struct, got %T", cfg))
+	}
+
+	// Check every field first so an unsupported type panics even if its variable is not set
+	checkConfigFields(v.Elem().Type())
+	var errs LoadErrors
+	e.loadStruct(v.Elem(), prefix, &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func Load(cfg interface{}, prefix string) error {
+	return Default().Load(cfg, prefix)
+}
+
+func (e *Env) loadStruct(v reflect.Value, prefix string, errs *LoadErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fieldVal := v.Field(i)
+
+		name, hasEnv := field.Tag.Lookup("env")
+		if !hasEnv {
+			if isNestedConfig(field.Type) {
+				if fieldVal.Kind() == reflect.Ptr {
+					if fieldVal.IsNil() {
+						fieldVal.Set(reflect.New(field.Type.Elem()))
+					}
+					fieldVal = fieldVal.Elem()
+				}
+				e.loadStruct(fieldVal, prefix+field.Tag.Get("prefix"), errs)
+			}
+			continue
+		}
+
+		envVar := prefix + name
+		if field.Tag.Get("secret") == "true" {
+			e.RegisterSensitive(envVar)
+		}
+		val, origin, found, err := e.lookup(envVar)
+		if err != nil {
+			*errs = append(*errs, err)
+			continue
+		}
+		if !found || val == "" {
+			defaultVal, hasDefault := field.Tag.Lookup("default")
+			if !hasDefault {
+				if field.Tag.Get("required") == "true" {
+					*errs = append(*errs, &EnvError{Var: envVar, Err: ErrNotSet})
+				}
+				continue
+			}
+			e.logDefault(envVar, defaultVal)
+			val, origin = defaultVal, OriginDefault
+		}
+
+		if err := setValue(fieldVal, val, field); err != nil {
+			*errs = append(*errs, e.newParseError(envVar, val, err))
+			continue
+		}
+		e.record(envVar, val, origin)
+	}
+}
+
+// Panics if a field with an env tag (in t or its nested configs) has a type that setValue can't set
+func checkConfigFields(t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if _, hasEnv := field.Tag.Lookup("env"); !hasEnv {
+			if isNestedConfig(field.Type) {
+				nested := field.Type
+				if nested.Kind() == reflect.Ptr {
+					nested = nested.Elem()
+				}
+				checkConfigFields(nested)
+			}
+			continue
+		}
+		if !isSupportedType(field.Type) {
+			panic(fmt.Sprintf("environments.Load: unsupported type %s for field %s", field.Type, field.Name))
+		}
+	}
+}
+
+// The types setValue can set
+func isSupportedType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		return isSupportedType(t.Elem())
+	}
+	if isValueType(t) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return isSupportedType(t.Elem())
+	case reflect.Map:
+		return isSupportedType(t.Key()) && isSupportedType(t.Elem())
+	}
+	return false
+}
+
+// Structs (or pointers to them) that are not a value type themselves
+func isNestedConfig(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && !isValueType(t)
+}
+
+func isValueType(t reflect.Type) bool {
+	ptr := reflect.PtrTo(t)
+	return t == urlType || ptr.Implements(unmarshalerType) || ptr.Implements(textUnmarshalerType)
+}
+
+func setValue(v reflect.Value, val string, field reflect.StructField) error {
+	if v.Kind() == reflect.Ptr {
+		ptr := reflect.New(v.Type().Elem())
+		if err := setValue(ptr.Elem(), val, field); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	}
+
+	switch u := v.Addr().Interface().(type) {
+	case Unmarshaler:
+		return u.UnmarshalEnv(val)
+	case encoding.TextUnmarshaler:
+		return u.UnmarshalText([]byte(val))
+	}
+
+	switch v.Type() {
+	case durationType:
+		d, err := parseDuration(val)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case urlType:
+		u, err := parseURL(val)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(*u))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if oneof, ok := field.Tag.Lookup("oneof"); ok {
+			if _, err := parseEnum(strings.Fields(oneof))(val); err != nil {
+				return err
+			}
+		}
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := parseBool(val)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(val), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(strings.TrimSpace(val), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		sep := field.Tag.Get("sep")
+		if sep == "" {
+			sep = ","
+		}
+		items, _ := parseStringSlice(sep)(val)
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setValue(slice.Index(i), item, field); err != nil {
+				return fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+		v.Set(slice)
+	case reflect.Map:
+		pairs, err := parseMap(val)
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(pairs))
+		for k, pairVal := range pairs {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := setValue(key, k, field); err != nil {
+				return fmt.Errorf("key %s: %w", k, err)
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setValue(elem, pairVal, field); err != nil {
+				return fmt.Errorf("key %s: %w", k, err)
+			}
+			m.SetMapIndex(key, elem)
+		}
+		v.Set(m)
+	default:
+		// Not reached-- Load checks the field types with isSupportedType first
+		panic(fmt.Sprintf("environments.Load: unsupported type %s for field %s", v.Type(), field.Name))
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package environments
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+/*********************************************
+ * Sensitive Variables
+ *
+ * The values of sensitive variables are always masked in logs and in Report
+ * A variable is sensitive if it was registered with RegisterSensitive, loaded by Load from a field with the `secret:"true"` tag,
+ * or its name contains one of SensitivePatterns (ex: DATABASE_PASSWORD, STRIPE_SECRET_KEY, GITHUB_TOKEN)
+ * *******************************************/
+
+const secretMask = "****"
+
+// Matched against the upper-cased name-- it's better to mask too much than too little
+var SensitivePatterns = []string{"PASSWORD", "SECRET", "TOKEN", "KEY"}
+
+// Marks the variables as sensitive even if their names don't look like it (ex: DATABASE_URL, which can have a password)
+func (e *Env) RegisterSensitive(envVars ...string) {
+	e.sensitiveMu.Lock()
+	defer e.sensitiveMu.Unlock()
+	for _, envVar := range envVars {
+		e.sensitive[envVar] = true
+	}
+}
+
+func (e *Env) IsSensitive(envVar string) bool {
+	e.sensitiveMu.RLock()
+	registered := e.sensitive[envVar]
+	e.sensitiveMu.RUnlock()
+	if registered {
+		return true
+	}
+	upper := strings.ToUpper(envVar)
+	for _, pattern := range SensitivePatterns {
+		if strings.Contains(upper, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the value to show in logs-- masked if the variable is sensitive (empty values are left empty so it's clear they're not set)
+func (e *Env) Mask(envVar string, value string) string {
+	if value != "" && e.IsSensitive(envVar) {
+		return secretMask
+	}
+	return value
+}
+
+func RegisterSensitive(envVars ...string) {
+	Default().RegisterSensitive(envVars...)
+}
+
+func IsSensitive(envVar string) bool {
+	return Default().IsSensitive(envVar)
+}
+
+func Mask(envVar string, value string) string {
+	return Default().Mask(envVar, value)
+}
+
+func (e *Env) logDefault(envVar string, defaultVal string) {
+	e.Logger().Info(fmt.Sprintf("Env var: '%s' not found or empty.  Setting to default value: '%s'", envVar, e.Mask(envVar, defaultVal)))
+}
+
+/*********************************************
+ * Report
+ *
+ * Every variable read through an Env is recorded with the value that was used and where it came from
+ * so the effective config can be printed at startup (ex: environments.Report(os.Stdout))
+ * *******************************************/
+
+// Where the value of a variable came from-- the name of the Source it was found in, or one of these
+type Origin string
+
+const (
+	OriginDefault Origin = "default"
+	// The file named by VAR_FILE
+	OriginFile Origin = "file"
+)
+
+type ReportEntry struct {
+	Var    string
+	Value  string
+	Origin Origin
+}
+
+func (e *Env) record(envVar string, value string, origin Origin) {
+	e.reportMu.Lock()
+	defer e.reportMu.Unlock()
+	e.report[envVar] = ReportEntry{Var: envVar, Value: value, Origin: origin}
+}
+
+// Returns where the value of a variable read so far came from, or false if it has not been read
+// Ex: to tell if a variable was set or got the default from Load
+func (e *Env) OriginOf(envVar string) (Origin, bool) {
+	e.reportMu.Lock()
+	defer e.reportMu.Unlock()
+	entry, ok := e.report[envVar]
+	return entry.Origin, ok
+}
+
+// Returns every variable read so far sorted by name, with the sensitive values masked
+func (e *Env) ReportEntries() []ReportEntry {
+	e.reportMu.Lock()
+	entries := make([]ReportEntry, 0, len(e.report))
+	for _, entry := range e.report {
+		entries = append(entries, entry)
+	}
+	e.reportMu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Var < entries[j].Var })
+	for i := range entries {
+		entries[i].Value = e.Mask(entries[i].Var, entries[i].Value)
+	}
+	return entries
+}
+
+// Writes one line per variable read so far (ex: "DATABASE_PASSWORD=**** (env)")
+func (e *Env) Report(w io.Writer) error {
+	for _, entry := range e.ReportEntries() {
+		if _, err := fmt.Fprintf(w, "%s=%s (%s)\n", entry.Var, entry.Value, entry.Origin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ReportEntries() []ReportEntry {
+	return Default().ReportEntries()
+}
+
+func Report(w io.Writer) error {
+	return Default().Report(w)
+}
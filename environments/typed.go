@@ -0,0 +1,343 @@
+package environments
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*********************************************
+ * Typed Getters
+ *
+ * Parse the variable into the type and return an error naming the variable if it can't be parsed
+ * Required getters return ErrNotSet if the variable is not set (or empty)
+ * Optional getters return the default only if the variable is not set (or empty)--
+ * a value that is set but invalid is always an error rather than silently falling back to the default
+ * *******************************************/
+
+var ErrNotSet = errors.New("not set")
+
+// The error returned by the typed getters
+type EnvError struct {
+	Var   string
+	Value string
+	Err   error
+}
+
+func (e *EnvError) Error() string {
+	if errors.Is(e.Err, ErrNotSet) {
+		return fmt.Sprintf("env var %s: %s", e.Var, e.Err)
+	}
+	return fmt.Sprintf("env var %s: invalid value %q: %s", e.Var, e.Value, e.Err)
+}
+
+func (e *EnvError) Unwrap() error {
+	return e.Err
+}
+
+func getRequired[T any](e *Env, envVar string, parse func(string) (T, error)) (T, error) {
+	var zero T
+	val, origin, found, err := e.lookup(envVar)
+	if err != nil {
+		return zero, err
+	}
+	if !found || val == "" {
+		return zero, &EnvError{Var: envVar, Err: ErrNotSet}
+	}
+	parsed, err := parse(val)
+	if err != nil {
+		return zero, e.newParseError(envVar, val, err)
+	}
+	e.record(envVar, val, origin)
+	return parsed, nil
+}
+
+func getOptional[T any](e *Env, envVar string, defaultVal T, parse func(string) (T, error)) (T, error) {
+	val, origin, found, err := e.lookup(envVar)
+	if err != nil {
+		return defaultVal, err
+	}
+	if !found || val == "" {
+		defaultStr := fmt.Sprintf("%v", defaultVal)
+		e.logDefault(envVar, defaultStr)
+		e.record(envVar, defaultStr, OriginDefault)
+		return defaultVal, nil
+	}
+	parsed, err := parse(val)
+	if err != nil {
+		return defaultVal, e.newParseError(envVar, val, err)
+	}
+	e.record(envVar, val, origin)
+	return parsed, nil
+}
+
+// Parse errors usually repeat the value, so they are replaced for sensitive variables
+func (e *Env) newParseError(envVar string, val string, err error) *EnvError {
+	if e.IsSensitive(envVar) {
+		return &EnvError{Var: envVar, Value: secretMask, Err: errors.New("cannot be parsed")}
+	}
+	return &EnvError{Var: envVar, Value: val, Err: err}
+}
+
+/*********************************************
+ * Parsers
+ * *******************************************/
+
+func parseString(val string) (string, error) {
+	return val, nil
+}
+
+func parseInt(val string) (int, error) {
+	return strconv.Atoi(strings.TrimSpace(val))
+}
+
+func parseFloat(val string) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSpace(val), 64)
+}
+
+// Also accepts yes/no and on/off since those show up in a lot of deploy configs
+func parseBool(val string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(val)) {
+	case "yes", "on":
+		return true, nil
+	case "no", "off":
+		return false, nil
+	}
+	return strconv.ParseBool(strings.TrimSpace(val))
+}
+
+// Requires a unit (ex: "30s", "5m")-- a bare number is an error instead of being read as nanoseconds
+func parseDuration(val string) (time.Duration, error) {
+	return time.ParseDuration(strings.TrimSpace(val))
+}
+
+// Requires an absolute url (with a scheme)
+func parseURL(val string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(val))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" {
+		return nil, errors.New("url must be absolute")
+	}
+	return u, nil
+}
+
+func parseUUID(val string) (uuid.UUID, error) {
+	return uuid.Parse(strings.TrimSpace(val))
+}
+
+// Items are trimmed and empty items are dropped (ex: "a, b,,c" => [a b c])
+func parseStringSlice(sep string) func(string) ([]string, error) {
+	return func(val string) ([]string, error) {
+		items := []string{}
+		for _, item := range strings.Split(val, sep) {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	}
+}
+
+// Comma separated key=value pairs (ex: "region=us,tier=free")
+func parseMap(val string) (map[string]string, error) {
+	m := map[string]string{}
+	for _, pair := range strings.Split(val, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, "=")
+		if !found || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("%q is not a key=value pair", pair)
+		}
+		m[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return m, nil
+}
+
+func parseEnum(allowed []string) func(string) (string, error) {
+	return func(val string) (string, error) {
+		for _, a := range allowed {
+			if val == a {
+				return val, nil
+			}
+		}
+		return "", fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+/*********************************************
+ * Getters
+ * *******************************************/
+
+// Same as GetRequiredEnv but returns an error instead of panicking
+func (e *Env) GetRequiredStringEnv(envVar string) (string, error) {
+	return getRequired(e, envVar, parseString)
+}
+
+func (e *Env) GetOptionalStringEnv(envVar string, defaultVal string) (string, error) {
+	return getOptional(e, envVar, defaultVal, parseString)
+}
+
+func (e *Env) GetRequiredIntEnv(envVar string) (int, error) {
+	return getRequired(e, envVar, parseInt)
+}
+
+func (e *Env) GetOptionalIntEnv(envVar string, defaultVal int) (int, error) {
+	return getOptional(e, envVar, defaultVal, parseInt)
+}
+
+func (e *Env) GetRequiredFloatEnv(envVar string) (float64, error) {
+	return getRequired(e, envVar, parseFloat)
+}
+
+func (e *Env) GetOptionalFloatEnv(envVar string, defaultVal float64) (float64, error) {
+	return getOptional(e, envVar, defaultVal, parseFloat)
+}
+
+// Accepts anything strconv.ParseBool does plus yes/no and on/off
+func (e *Env) GetRequiredBoolEnv(envVar string) (bool, error) {
+	return getRequired(e, envVar, parseBool)
+}
+
+func (e *Env) GetOptionalBoolEnv(envVar string, defaultVal bool) (bool, error) {
+	return getOptional(e, envVar, defaultVal, parseBool)
+}
+
+// Uses time.ParseDuration, so the value needs a unit (ex: "30s")
+func (e *Env) GetRequiredDurationEnv(envVar string) (time.Duration, error) {
+	return getRequired(e, envVar, parseDuration)
+}
+
+func (e *Env) GetOptionalDurationEnv(envVar string, defaultVal time.Duration) (time.Duration, error) {
+	return getOptional(e, envVar, defaultVal, parseDuration)
+}
+
+func (e *Env) GetRequiredURLEnv(envVar string) (*url.URL, error) {
+	return getRequired(e, envVar, parseURL)
+}
+
+func (e *Env) GetOptionalURLEnv(envVar string, defaultVal *url.URL) (*url.URL, error) {
+	return getOptional(e, envVar, defaultVal, parseURL)
+}
+
+func (e *Env) GetRequiredUUIDEnv(envVar string) (uuid.UUID, error) {
+	return getRequired(e, envVar, parseUUID)
+}
+
+func (e *Env) GetOptionalUUIDEnv(envVar string, defaultVal uuid.UUID) (uuid.UUID, error) {
+	return getOptional(e, envVar, defaultVal, parseUUID)
+}
+
+// Splits the value on sep (ex: "," or ":")
+func (e *Env) GetRequiredStringSliceEnv(envVar string, sep string) ([]string, error) {
+	return getRequired(e, envVar, parseStringSlice(sep))
+}
+
+func (e *Env) GetOptionalStringSliceEnv(envVar string, sep string, defaultVal []string) ([]string, error) {
+	return getOptional(e, envVar, defaultVal, parseStringSlice(sep))
+}
+
+// Parses comma separated key=value pairs (ex: "region=us,tier=free")
+func (e *Env) GetRequiredMapEnv(envVar string) (map[string]string, error) {
+	return getRequired(e, envVar, parseMap)
+}
+
+func (e *Env) GetOptionalMapEnv(envVar string, defaultVal map[string]string) (map[string]string, error) {
+	return getOptional(e, envVar, defaultVal, parseMap)
+}
+
+// Returns an error if the value is not exactly one of the allowed values
+func (e *Env) GetRequiredEnumEnv(envVar string, allowed []string) (string, error) {
+	return getRequired(e, envVar, parseEnum(allowed))
+}
+
+// The default does not have to be one of the allowed values (ex: "" to mean unset)
+func (e *Env) GetOptionalEnumEnv(envVar string, defaultVal string, allowed []string) (string, error) {
+	return getOptional(e, envVar, defaultVal, parseEnum(allowed))
+}
+
+func GetRequiredStringEnv(envVar string) (string, error) {
+	return Default().GetRequiredStringEnv(envVar)
+}
+
+func GetOptionalStringEnv(envVar string, defaultVal string) (string, error) {
+	return Default().GetOptionalStringEnv(envVar, defaultVal)
+}
+
+func GetRequiredIntEnv(envVar string) (int, error) {
+	return Default().GetRequiredIntEnv(envVar)
+}
+
+func GetOptionalIntEnv(envVar string, defaultVal int) (int, error) {
+	return Default().GetOptionalIntEnv(envVar, defaultVal)
+}
+
+func GetRequiredFloatEnv(envVar string) (float64, error) {
+	return Default().GetRequiredFloatEnv(envVar)
+}
+
+func GetOptionalFloatEnv(envVar string, defaultVal float64) (float64, error) {
+	return Default().GetOptionalFloatEnv(envVar, defaultVal)
+}
+
+func GetRequiredBoolEnv(envVar string) (bool, error) {
+	return Default().GetRequiredBoolEnv(envVar)
+}
+
+func GetOptionalBoolEnv(envVar string, defaultVal bool) (bool, error) {
+	return Default().GetOptionalBoolEnv(envVar, defaultVal)
+}
+
+func GetRequiredDurationEnv(envVar string) (time.Duration, error) {
+	return Default().GetRequiredDurationEnv(envVar)
+}
+
+func GetOptionalDurationEnv(envVar string, defaultVal time.Duration) (time.Duration, error) {
+	return Default().GetOptionalDurationEnv(envVar, defaultVal)
+}
+
+func GetRequiredURLEnv(envVar string) (*url.URL, error) {
+	return Default().GetRequiredURLEnv(envVar)
+}
+
+func GetOptionalURLEnv(envVar string, defaultVal *url.URL) (*url.URL, error) {
+	return Default().GetOptionalURLEnv(envVar, defaultVal)
+}
+
+func GetRequiredUUIDEnv(envVar string) (uuid.UUID, error) {
+	return Default().GetRequiredUUIDEnv(envVar)
+}
+
+func GetOptionalUUIDEnv(envVar string, defaultVal uuid.UUID) (uuid.UUID, error) {
+	return Default().GetOptionalUUIDEnv(envVar, defaultVal)
+}
+
+func GetRequiredStringSliceEnv(envVar string, sep string) ([]string, error) {
+	return Default().GetRequiredStringSliceEnv(envVar, sep)
+}
+
+func GetOptionalStringSliceEnv(envVar string, sep string, defaultVal []string) ([]string, error) {
+	return Default().GetOptionalStringSliceEnv(envVar, sep, defaultVal)
+}
+
+func GetRequiredMapEnv(envVar string) (map[string]string, error) {
+	return Default().GetRequiredMapEnv(envVar)
+}
+
+func GetOptionalMapEnv(envVar string, defaultVal map[string]string) (map[string]string, error) {
+	return Default().GetOptionalMapEnv(envVar, defaultVal)
+}
+
+func GetRequiredEnumEnv(envVar string, allowed []string) (string, error) {
+	return Default().GetRequiredEnumEnv(envVar, allowed)
+}
+
+func GetOptionalEnumEnv(envVar string, defaultVal string, allowed []string) (string, error) {
+	return Default().GetOptionalEnumEnv(envVar, defaultVal, allowed)
+}
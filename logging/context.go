@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"context"
+	"sync"
+)
+
+type contextKey struct{}
+
+// Holds the per-request fields
+// It is mutable so that middlewares further down the chain can add fields
+// that the middlewares higher up the chain will see in their logs (ex: requester id in the "Finished" line)
+type requestFields struct {
+	mu     sync.Mutex
+	logger Logger
+	fields Fields
+}
+
+// Returns a context that carries a request-scoped logger
+// Fields added later with AddFields will show up in every log made with FromContext(ctx)
+func NewContext(ctx context.Context, l Logger, fields Fields) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestFields{logger: l, fields: mergeFields(fields)})
+}
+
+// Adds fields to the request-scoped logger in the context
+// Does nothing if the context was not created with NewContext
+func AddFields(ctx context.Context, fields Fields) {
+	rf, ok := ctx.Value(contextKey{}).(*requestFields)
+	if !ok {
+		return
+	}
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	rf.fields = mergeFields(rf.fields, fields)
+}
+
+// Returns the request-scoped logger with all its fields, or the default logger if there is none
+func FromContext(ctx context.Context) Logger {
+	rf, ok := ctx.Value(contextKey{}).(*requestFields)
+	if !ok {
+		return Default()
+	}
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.logger.With(rf.fields)
+}
@@ -0,0 +1,190 @@
+package logging
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// Parses a level from its name (case-insensitive) -- useful for reading the level from an env var
+// Returns false if the name is not a known level
+func ParseLevel(name string) (Level, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LevelDebug, true
+	case "info":
+		return LevelInfo, true
+	case "warn", "warning":
+		return LevelWarn, true
+	case "error":
+		return LevelError, true
+	}
+	return LevelInfo, false
+}
+
+// Standard field names used by this library so that log aggregators can index them
+const (
+	FieldTraceId     = "trace_id"
+	FieldSpanId      = "span_id"
+	FieldRequesterId = "requester_id"
+	FieldRoute       = "route"
+	FieldMethod      = "method"
+	FieldURI         = "uri"
+	FieldStatus      = "status"
+	FieldSize        = "size"
+	FieldDuration    = "duration"
+	FieldError       = "error"
+)
+
+type Fields map[string]interface{}
+
+// A single log line handed to a Sink
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  Fields
+}
+
+// A Sink is where log entries end up (ex: json lines on stderr, colored text on a terminal)
+// Implement this in order to plug in a different output
+type Sink interface {
+	Write(entry Entry) error
+}
+
+type Logger interface {
+	Debug(msg string, fields ...Fields)
+	Info(msg string, fields ...Fields)
+	Warn(msg string, fields ...Fields)
+	Error(msg string, fields ...Fields)
+	Log(level Level, msg string, fields ...Fields)
+	// Returns a new logger that adds the fields to every entry
+	With(fields Fields) Logger
+	Enabled(level Level) bool
+}
+
+type logger struct {
+	sink   Sink
+	level  Level
+	fields Fields
+}
+
+// Creates a Logger that writes every entry at or above `level` to the sink
+func New(sink Sink, level Level) Logger {
+	return &logger{sink: sink, level: level}
+}
+
+func (l *logger) Debug(msg string, fields ...Fields) { l.Log(LevelDebug, msg, fields...) }
+func (l *logger) Info(msg string, fields ...Fields)  { l.Log(LevelInfo, msg, fields...) }
+func (l *logger) Warn(msg string, fields ...Fields)  { l.Log(LevelWarn, msg, fields...) }
+func (l *logger) Error(msg string, fields ...Fields) { l.Log(LevelError, msg, fields...) }
+
+func (l *logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *logger) Log(level Level, msg string, fields ...Fields) {
+	if !l.Enabled(level) {
+		return
+	}
+	// Errors writing logs are ignored -- there is nowhere sensible to report them
+	_ = l.sink.Write(Entry{
+		Time:    time.Now(),
+		Level:   level,
+		Message: msg,
+		Fields:  mergeFields(append([]Fields{l.fields}, fields...)...),
+	})
+}
+
+func (l *logger) With(fields Fields) Logger {
+	return &logger{sink: l.sink, level: l.level, fields: mergeFields(l.fields, fields)}
+}
+
+// Later fields override earlier ones with the same key
+func mergeFields(fieldsList ...Fields) Fields {
+	merged := Fields{}
+	for _, fields := range fieldsList {
+		for k, v := range fields {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// Convenience constructors for the two built-in sinks-- both write to stderr like the standard log package
+
+func NewJSONLogger(level Level) Logger {
+	return New(NewJSONSink(os.Stderr), level)
+}
+
+func NewConsoleLogger(level Level) Logger {
+	return New(NewConsoleSink(os.Stderr), level)
+}
+
+/*********************************************
+ * Default Logger
+ *
+ * The logging in this library goes through the default logger unless a Logger is passed in (ex: RunConfig.Logger)
+ * It writes json lines, or colored text when stderr is a terminal, so escape codes never end up in production logs
+ * Set it once at startup (before starting any servers) to change the format or level
+ * Ex:  logging.SetDefault(logging.NewJSONLogger(logging.LevelInfo))
+ * *******************************************/
+
+var defaultMu sync.RWMutex
+var defaultLogger = newDefaultLogger()
+
+func newDefaultLogger() Logger {
+	if isTerminal(os.Stderr) {
+		return NewConsoleLogger(LevelDebug)
+	}
+	return NewJSONLogger(LevelDebug)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func Default() Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultLogger
+}
+
+func SetDefault(l Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLogger = l
+}
+
+// Returns l, or the default logger if l is nil-- for the Logger fields that are optional
+func OrDefault(l Logger) Logger {
+	if l == nil {
+		return Default()
+	}
+	return l
+}
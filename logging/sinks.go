@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const boldPrint = "\033[1m"
+const headerPrint = "\033[95m"
+const warnPrint = "\033[93m"
+const errorPrint = "\033[91m"
+const endPrint = "\033[0m"
+
+/*********************************************
+ * JSON Lines
+ * *******************************************/
+
+type jsonSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Writes one json object per line with "time", "level" and "msg" keys, and every field as a top-level key
+// Use this in production so that log aggregators can parse the output
+func NewJSONSink(w io.Writer) Sink {
+	return &jsonSink{w: w}
+}
+
+func (s *jsonSink) Write(entry Entry) error {
+	line := make(map[string]interface{}, len(entry.Fields)+3)
+	for k, v := range entry.Fields {
+		line[k] = jsonFieldValue(v)
+	}
+	line["time"] = entry.Time.UTC().Format(time.RFC3339Nano)
+	line["level"] = entry.Level.String()
+	line["msg"] = entry.Message
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
+
+// Errors and durations don't marshal into anything useful by default
+func jsonFieldValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case error:
+		return val.Error()
+	case time.Duration:
+		return val.Seconds()
+	case fmt.Stringer:
+		return val.String()
+	}
+	return v
+}
+
+/*********************************************
+ * Console
+ * *******************************************/
+
+type consoleSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Writes human-readable, colored lines-- meant for local development, NOT for production
+// Ex:  2021/11/02 15:04:05 INFO  Finished request  route=/users/{id} status=200
+func NewConsoleSink(w io.Writer) Sink {
+	return &consoleSink{w: w}
+}
+
+func (s *consoleSink) Write(entry Entry) error {
+	color := headerPrint
+	switch entry.Level {
+	case LevelWarn:
+		color = warnPrint
+	case LevelError:
+		color = errorPrint
+	}
+
+	var b strings.Builder
+	b.WriteString(entry.Time.Format("2006/01/02 15:04:05 "))
+	b.WriteString(boldPrint + color)
+	b.WriteString(fmt.Sprintf("%-5s %s", strings.ToUpper(entry.Level.String()), entry.Message))
+	b.WriteString(endPrint)
+
+	keys := make([]string, 0, len(entry.Fields))
+	for k := range entry.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(fmt.Sprintf("  %s=%v", k, entry.Fields[k]))
+	}
+	b.WriteString("\n")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := io.WriteString(s.w, b.String())
+	return err
+}
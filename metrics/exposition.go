@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const TextContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Writes every metric in the Prometheus text exposition format
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	families := make(map[string]*family, len(r.families))
+	for name, f := range r.families {
+		families[name] = f
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		families[name].writeText(&b)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (f *family) writeText(b *strings.Builder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.series) == 0 {
+		return
+	}
+	b.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+	b.WriteString("# TYPE " + f.name + " " + string(f.typ) + "\n")
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.typ != histogramType {
+			value := s.value
+			if fn, ok := f.funcs[key]; ok {
+				value = fn()
+			}
+			b.WriteString(f.name + formatLabels(f.labelNames, s.labelValues, "", "") + " " + formatFloat(value) + "\n")
+			continue
+		}
+
+		for i, upperBound := range f.buckets {
+			b.WriteString(f.name + "_bucket" + formatLabels(f.labelNames, s.labelValues, "le", formatFloat(upperBound)) + " " + formatFloat(float64(s.bucketCounts[i])) + "\n")
+		}
+		b.WriteString(f.name + "_bucket" + formatLabels(f.labelNames, s.labelValues, "le", "+Inf") + " " + formatFloat(float64(s.count)) + "\n")
+		b.WriteString(f.name + "_sum" + formatLabels(f.labelNames, s.labelValues, "", "") + " " + formatFloat(s.value) + "\n")
+		b.WriteString(f.name + "_count" + formatLabels(f.labelNames, s.labelValues, "", "") + " " + formatFloat(float64(s.count)) + "\n")
+	}
+}
+
+func formatLabels(names []string, values []string, extraName string, extraValue string) string {
+	pairs := []string{}
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escapeLabelValue(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabelValue(v string) string { return labelValueEscaper.Replace(v) }
+func escapeHelp(v string) string       { return helpEscaper.Replace(v) }
+
+// Serves the metrics for Prometheus to scrape
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", TextContentType)
+		// Nothing more can be done if writing fails-- the scrape will just fail
+		_ = r.WriteText(w)
+	})
+}
@@ -0,0 +1,239 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*********************************************
+ * Metrics
+ *
+ * A small, dependency-free implementation of counters, gauges and histograms
+ * that are exposed in the Prometheus text format (see Registry.Handler)
+ *
+ * Ex:
+ *   registry := metrics.NewRegistry()
+ *   jobs := registry.NewCounter("jobs_processed_total", "Jobs processed", "queue", "result")
+ *   jobs.Inc("emails", "ok")
+ *
+ * Label values are passed positionally in the same order as the label names
+ * *******************************************/
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+// Default histogram buckets (in seconds)-- same as the Prometheus client defaults
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Static labels for func metrics (ex: {"db": "users"})
+type Labels map[string]string
+
+type Registry struct {
+	mu       sync.RWMutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+// All the series with the same name
+type family struct {
+	mu         sync.Mutex
+	name       string
+	help       string
+	typ        metricType
+	labelNames []string
+	buckets    []float64
+	series     map[string]*series
+	funcs      map[string]func() float64
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// Histograms only
+	bucketCounts []uint64
+	count        uint64
+}
+
+// Returns the family with the name, creating it if it doesn't exist yet
+// so that registering the same metric twice (ex: two routers sharing a registry) returns the same one
+// Panics if the existing one has a different type or labels, since that is a programming error
+func (r *Registry) family(name string, help string, typ metricType, labelNames []string, buckets []float64) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.families[name]; ok {
+		if existing.typ != typ || strings.Join(existing.labelNames, ",") != strings.Join(labelNames, ",") {
+			panic(fmt.Sprintf("metric %s already registered with a different type or labels", name))
+		}
+		return existing
+	}
+	f := &family{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     map[string]*series{},
+		funcs:      map[string]func() float64{},
+	}
+	r.families[name] = f
+	return f
+}
+
+func (f *family) getSeries(labelValues []string) *series {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		if f.typ == histogramType {
+			s.bucketCounts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+/*********************************************
+ * Counter
+ * *******************************************/
+
+type Counter struct {
+	f *family
+}
+
+func (r *Registry) NewCounter(name string, help string, labelNames ...string) *Counter {
+	return &Counter{f: r.family(name, help, counterType, labelNames, nil)}
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Panics if value is negative-- counters only go up
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", c.f.name))
+	}
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c.f.getSeries(labelValues).value += value
+}
+
+/*********************************************
+ * Gauge
+ * *******************************************/
+
+type Gauge struct {
+	f *family
+}
+
+func (r *Registry) NewGauge(name string, help string, labelNames ...string) *Gauge {
+	return &Gauge{f: r.family(name, help, gaugeType, labelNames, nil)}
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.getSeries(labelValues).value = value
+}
+
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.getSeries(labelValues).value += value
+}
+
+func (g *Gauge) Inc(labelValues ...string) { g.Add(1, labelValues...) }
+func (g *Gauge) Dec(labelValues ...string) { g.Add(-1, labelValues...) }
+
+/*********************************************
+ * Histogram
+ * *******************************************/
+
+type Histogram struct {
+	f *family
+}
+
+// Pass nil buckets to use DefaultBuckets
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{f: r.family(name, help, histogramType, labelNames, buckets)}
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s := h.f.getSeries(labelValues)
+	s.value += value
+	s.count++
+	for i, upperBound := range h.f.buckets {
+		if value <= upperBound {
+			s.bucketCounts[i]++
+		}
+	}
+}
+
+/*********************************************
+ * Func Metrics
+ *
+ * Values that are read when the metrics are scraped (ex: connection pool stats)
+ * Registering the same name and labels again replaces the func
+ * *******************************************/
+
+func (r *Registry) RegisterGaugeFunc(name string, help string, labels Labels, fn func() float64) {
+	r.registerFunc(name, help, gaugeType, labels, fn)
+}
+
+// fn must never return a smaller value than before
+func (r *Registry) RegisterCounterFunc(name string, help string, labels Labels, fn func() float64) {
+	r.registerFunc(name, help, counterType, labels, fn)
+}
+
+func (r *Registry) registerFunc(name string, help string, typ metricType, labels Labels, fn func() float64) {
+	labelNames := make([]string, 0, len(labels))
+	for k := range labels {
+		labelNames = append(labelNames, k)
+	}
+	sort.Strings(labelNames)
+	labelValues := make([]string, len(labelNames))
+	for i, k := range labelNames {
+		labelValues[i] = labels[k]
+	}
+
+	f := r.family(name, help, typ, labelNames, nil)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.Join(labelValues, "\xff")
+	f.getSeries(labelValues)
+	f.funcs[key] = fn
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return fmt.Sprint(v)
+}
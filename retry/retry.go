@@ -0,0 +1,141 @@
+package retry
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+/*********************************************
+ * Retry
+ *
+ * Calls a function until it succeeds, waiting longer between each attempt
+ * Ex:
+ *   err := retry.Do(ctx, retry.DefaultPolicy(), func(ctx context.Context) error {
+ *       return dbConn.PingContext(ctx)
+ *   })
+ * *******************************************/
+
+type Jitter int
+
+const (
+	// Waits exactly the backoff
+	NoJitter Jitter = iota
+	// Waits a random time between 0 and the backoff-- spreads out clients that fail at the same time
+	FullJitter
+	// Waits a random time between InitialDelay and 3x the last wait (capped at MaxDelay)
+	// https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+	DecorrelatedJitter
+)
+
+type Policy struct {
+	// Includes the first attempt-- 0 means no limit (so set MaxElapsed or use a context with a deadline)
+	MaxAttempts int
+	// Stops retrying once the next wait would end after this much time since the first attempt-- 0 means no limit
+	MaxElapsed time.Duration
+	// The wait after the first failure
+	InitialDelay time.Duration
+	// The longest wait between attempts-- 0 means no limit
+	MaxDelay time.Duration
+	// How much the wait grows after each failure-- 0 is treated as 2, use 1 for a fixed wait
+	Multiplier float64
+	Jitter     Jitter
+	// Returns false for errors that won't go away by retrying (ex: wrong password)-- nil retries every error
+	Retryable func(err error) bool
+	// Called before each wait with the attempt that just failed (starting at 1), its error, and how long it will wait
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+// 5 attempts over a couple seconds
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:  5,
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     10 * time.Second,
+		Multiplier:   2,
+		Jitter:       FullJitter,
+	}
+}
+
+// Calls fn until it returns nil, the error is not retryable, or the policy or ctx runs out
+// Returns the last error from fn-- or ctx.Err() if ctx is done before the first attempt
+func Do(ctx context.Context, policy Policy, fn func(ctx context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if policy.Retryable != nil && !policy.Retryable(err) {
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		delay = policy.backoff(attempt, delay)
+		if policy.MaxElapsed > 0 && time.Since(start)+delay > policy.MaxElapsed {
+			return err
+		}
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// The wait after the attempt failed, given the last wait
+func (p Policy) backoff(attempt int, lastDelay time.Duration) time.Duration {
+	if p.Jitter == DecorrelatedJitter {
+		upper := 3 * lastDelay
+		if upper < p.InitialDelay {
+			upper = p.InitialDelay
+		}
+		return p.capDelay(p.InitialDelay + randDuration(upper-p.InitialDelay))
+	}
+
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	delay := p.capDelay(time.Duration(float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))))
+	if p.Jitter == FullJitter {
+		return randDuration(delay)
+	}
+	return delay
+}
+
+func (p Policy) capDelay(delay time.Duration) time.Duration {
+	// A float that is too big for a Duration overflows to a negative number
+	if p.MaxDelay > 0 && (delay > p.MaxDelay || delay < 0) {
+		return p.MaxDelay
+	}
+	if delay < 0 {
+		return math.MaxInt64
+	}
+	return delay
+}
+
+// Between 0 and max (inclusive)
+func randDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	if max == math.MaxInt64 {
+		return time.Duration(rand.Int63())
+	}
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
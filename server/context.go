@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+type contextKey int
+
+const (
+	traceIdContextKey contextKey = iota
+	requesterIdContextKey
+	requestContextKey
+)
+
+/*********************************************
+ * Request-scoped values
+ *
+ * The middlewares store the values they parse in the request context
+ * so that handlers (and logicFuncs in the Standard Handlers) can get them from `r.Context()` without re-parsing headers
+ * *******************************************/
+
+func ContextWithTraceID(ctx context.Context, traceId uuid.UUID) context.Context {
+	return context.WithValue(ctx, traceIdContextKey, traceId)
+}
+
+// Returns the trace id set by AddLoggingMiddleware
+// Returns false if there is none (ex: the middleware is not used)
+func TraceIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	traceId, ok := ctx.Value(traceIdContextKey).(uuid.UUID)
+	return traceId, ok
+}
+
+func ContextWithRequesterID(ctx context.Context, requesterId uuid.UUID) context.Context {
+	return context.WithValue(ctx, requesterIdContextKey, requesterId)
+}
+
+// Returns the requester id validated by AddRequesterIdHeaderMiddleware
+// Returns false if there is none (ex: the middleware is not used)
+func RequesterIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	requesterId, ok := ctx.Value(requesterIdContextKey).(uuid.UUID)
+	return requesterId, ok
+}
+
+// Used by Handle so that logic funcs (which only get a context) can still get the request-- ex: for mux.Vars
+func ContextWithRequest(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, requestContextKey, r)
+}
+
+// Returns the request set by Handle, or nil if there is none
+func RequestFromContext(ctx context.Context) *http.Request {
+	r, _ := ctx.Value(requestContextKey).(*http.Request)
+	return r
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const originHeader = "Origin"
+
+// Describes which cross-origin requests are allowed
+//
+// An origin is allowed if it matches ANY of AllowedOrigins, AllowedOriginPatterns, or AllowOriginFunc
+// AllowedOrigins entries can be:
+//   - An exact origin:      "https://app.example.com"
+//   - A wildcard subdomain: "https://*.example.com"  (matches "https://a.example.com" but not "https://example.com")
+//   - Any origin:           "*"
+//
+// The matching origin is always reflected in the response (instead of sending "*")
+// except when "*" is allowed, which sends "*"
+// "*" can't be used with AllowCredentials-- that would let any website make requests with the user's cookies
+type CORSConfig struct {
+	AllowedOrigins []string
+	// Must match the whole origin-- patterns are always anchored (`example\.com` does not match "https://example.com.evil.com")
+	AllowedOriginPatterns []*regexp.Regexp
+	AllowOriginFunc       func(origin string, r *http.Request) bool
+	AllowedMethods        []string
+	// Use "*" to allow any header
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	MaxAge           time.Duration
+	AllowCredentials bool
+}
+
+// The config used by AddCORSMiddlewareAndEndpoint-- allows any origin without credentials (to use if web server is running locally)
+// To allow credentials, set AllowCredentials and replace "*" with the origins that are allowed
+func DefaultCORSConfig(requesterIdHeader string) CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{http.MethodPost, http.MethodOptions, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		AllowedHeaders: []string{
+			"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "accept", "origin", "Cache-Control", "X-Requested-With", "Session", requesterIdHeader,
+		},
+	}
+}
+
+var errCORSAnyOriginWithCredentials = errors.New(`CORS config can't allow credentials from any origin-- list the allowed origins instead of "*"`)
+
+// Returns an error if the config is unsafe to use
+func (c CORSConfig) Validate() error {
+	if c.AllowCredentials && c.allowsAnyOrigin() {
+		return errCORSAnyOriginWithCredentials
+	}
+	return nil
+}
+
+func (c CORSConfig) isOriginAllowed(origin string, r *http.Request) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if i := strings.Index(allowed, "*."); i != -1 {
+			prefix, suffix := allowed[:i], allowed[i+1:]
+			if len(origin) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(strings.ToLower(origin), strings.ToLower(prefix)) &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(suffix)) {
+				return true
+			}
+		}
+	}
+	for _, pattern := range c.AllowedOriginPatterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return c.AllowOriginFunc != nil && c.AllowOriginFunc(origin, r)
+}
+
+// Copies the patterns so they only match whole strings-- an unanchored pattern would let any origin that contains a match through
+func anchorPatterns(patterns []*regexp.Regexp) []*regexp.Regexp {
+	anchored := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		anchored[i] = regexp.MustCompile(`^(?:` + pattern.String() + `)$`)
+	}
+	return anchored
+}
+
+func (c CORSConfig) allowsAnyOrigin() bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c CORSConfig) isMethodAllowed(method string) bool {
+	// Simple methods are always allowed by browsers
+	if method == http.MethodGet || method == http.MethodHead || method == http.MethodPost {
+		return true
+	}
+	for _, allowed := range c.AllowedMethods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c CORSConfig) areHeadersAllowed(requestedHeaders string) bool {
+	for _, requested := range strings.Split(requestedHeaders, ",") {
+		requested = strings.TrimSpace(requested)
+		if requested == "" {
+			continue
+		}
+		found := false
+		for _, allowed := range c.AllowedHeaders {
+			if allowed == "*" || strings.EqualFold(allowed, requested) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Adds CORS headers to every request according to the config and handles preflight (OPTIONS) requests
+// Preflight requests from a disallowed origin, or with a disallowed method or headers, get a 403
+// Actual requests from a disallowed origin are passed through without CORS headers (and so the browser blocks the response)
+// Panics if the config is not valid (see CORSConfig.Validate)
+func AddCORSMiddlewareAndEndpointWithConfig(router *mux.Router, config CORSConfig) {
+	if err := config.Validate(); err != nil {
+		panic(err)
+	}
+	config.AllowedOriginPatterns = anchorPatterns(config.AllowedOriginPatterns)
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The response depends on the Origin header, so caches must not share responses across origins
+			w.Header().Add("Vary", originHeader)
+
+			origin := r.Header.Get(originHeader)
+			isPreflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !config.isOriginAllowed(origin, r) {
+				if isPreflight {
+					_ = WriteError(NewAPIError(http.StatusForbidden, "cors_origin_not_allowed", "Origin not allowed"), w, r)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if config.allowsAnyOrigin() {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if config.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !isPreflight {
+				if len(config.ExposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			requestedMethod := r.Header.Get("Access-Control-Request-Method")
+			requestedHeaders := r.Header.Get("Access-Control-Request-Headers")
+			if !config.isMethodAllowed(requestedMethod) || !config.areHeadersAllowed(requestedHeaders) {
+				_ = WriteError(NewAPIError(http.StatusForbidden, "cors_not_allowed", "Method or headers not allowed"), w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
+			if len(config.AllowedHeaders) == 1 && config.AllowedHeaders[0] == "*" {
+				// "*" is not treated as a wildcard by browsers for credentialed requests, so reflect what was asked for
+				w.Header().Set("Access-Control-Allow-Headers", requestedHeaders)
+			} else if len(config.AllowedHeaders) > 0 {
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+			}
+			if config.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+	// Any options requests return 204-- mux only runs middlewares when a route matches
+	// so this route makes sure preflight requests to any path reach the middleware above
+	router.PathPrefix("/").Methods(http.MethodOptions).HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/jsonapi"
+	"net/http"
+	"strconv"
+)
+
+const ProblemJSONContentType = "application/problem+json"
+
+// If false (the default), the details of 5xx errors that are not APIErrors are NOT sent to clients
+// since they can contain internal info (ex: DB error messages)
+// Set it to true at startup when running locally to see the full errors in responses
+var DebugErrors = false
+
+// An error with a single field of an input
+// Field is the path to the field in the input json (ex: "address.street" or "items[2].name")
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// An error that is meant to be sent to clients
+// Rendered as RFC 7807 problem+json, or as a JSON:API errors document if the request negotiated jsonapi
+//
+// Return one of these from a logicFunc (or preprocessFunc) to control exactly what the client sees
+// Any other error is converted with WrapError
+type APIError struct {
+	Status int
+	// Application-specific code that clients can switch on (ex: "not_found", "validation_failed")
+	Code  string
+	Title string
+	// Human-readable explanation specific to this occurrence of the problem
+	Detail string
+	Fields []FieldError
+	// The underlying error-- only logged, never sent to clients
+	Err error
+}
+
+func NewAPIError(status int, code string, detail string) *APIError {
+	return &APIError{
+		Status: status,
+		Code:   code,
+		Title:  http.StatusText(status),
+		Detail: detail,
+	}
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%d %s", e.Status, e.Title)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Converts any error into an APIError
+// If err is (or wraps) an APIError, that one is returned as is and status is ignored
+// ValidationErrors become a 422 with the per-field messages
+// Otherwise, the status is used (anything that is not an error status becomes a 500)
+// and the details of 5xx errors are masked unless DebugErrors is set
+func WrapError(err error, status int) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var validationErrs ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return &APIError{
+			Status: http.StatusUnprocessableEntity,
+			Code:   "validation_failed",
+			Title:  http.StatusText(http.StatusUnprocessableEntity),
+			Detail: "The input failed validation",
+			Fields: validationErrs,
+			Err:    err,
+		}
+	}
+
+	if status < 400 || status > 599 {
+		status = http.StatusInternalServerError
+	}
+	apiErr = &APIError{
+		Status: status,
+		Title:  http.StatusText(status),
+		Detail: err.Error(),
+		Err:    err,
+	}
+	if status >= 500 && !DebugErrors {
+		apiErr.Detail = ""
+	}
+	return apiErr
+}
+
+// The RFC 7807 representation
+type problemDetails struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code,omitempty"`
+	TraceId  string       `json:"traceId,omitempty"`
+	Fields   []FieldError `json:"fields,omitempty"`
+}
+
+// Writes the error to the response in the format the request negotiated
+func WriteError(apiErr *APIError, w http.ResponseWriter, r *http.Request) error {
+	title := apiErr.Title
+	if title == "" {
+		title = http.StatusText(apiErr.Status)
+	}
+	var traceId string
+	if id, ok := TraceIDFromContext(r.Context()); ok {
+		traceId = id.String()
+	}
+
+	if requestWantsJSONAPI(r) {
+		w.Header().Set(ContentTypeHeader, jsonapi.MediaType)
+		return CheckJSONMarshalAndWrite(jsonAPIErrors(apiErr, title, traceId), apiErr.Status, w)
+	}
+
+	w.Header().Set(ContentTypeHeader, ProblemJSONContentType)
+	return CheckJSONMarshalAndWrite(problemDetails{
+		Type:     "about:blank",
+		Title:    title,
+		Status:   apiErr.Status,
+		Detail:   apiErr.Detail,
+		Instance: r.URL.Path,
+		Code:     apiErr.Code,
+		TraceId:  traceId,
+		Fields:   apiErr.Fields,
+	}, apiErr.Status, w)
+}
+
+// JSON:API has no notion of a single error with many fields
+// so every field error becomes its own error object (with the field in the meta)
+func jsonAPIErrors(apiErr *APIError, title string, traceId string) *jsonapi.ErrorsPayload {
+	status := strconv.Itoa(apiErr.Status)
+	if len(apiErr.Fields) == 0 {
+		return &jsonapi.ErrorsPayload{Errors: []*jsonapi.ErrorObject{{
+			ID:     traceId,
+			Title:  title,
+			Detail: apiErr.Detail,
+			Status: status,
+			Code:   apiErr.Code,
+		}}}
+	}
+
+	payload := &jsonapi.ErrorsPayload{}
+	for _, fieldErr := range apiErr.Fields {
+		code := fieldErr.Code
+		if code == "" {
+			code = apiErr.Code
+		}
+		meta := map[string]interface{}{"field": fieldErr.Field}
+		payload.Errors = append(payload.Errors, &jsonapi.ErrorObject{
+			ID:     traceId,
+			Title:  title,
+			Detail: fieldErr.Message,
+			Status: status,
+			Code:   code,
+			Meta:   &meta,
+		})
+	}
+	return payload
+}
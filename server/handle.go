@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"github.com/Gamma169/go-server-helpers/logging"
+	"net/http"
+	"reflect"
+)
+
+/*********************************************
+ * Generic Handlers
+ *
+ * Type-safe versions of the Standard Handlers that return a ready http.HandlerFunc
+ * Ex:
+ *   func createUser(ctx context.Context, input *UserInput) (*User, int, error) {...}
+ *
+ *   router.Path("/users").Methods(http.MethodPost).HandlerFunc(server.Handle(createUser))
+ *
+ * Unlike the Standard Handlers:
+ *   - A fresh input is allocated for every request, so there is no shared inputPtr between concurrent requests
+ *   - The logic func gets the input as its own type, so no type assertions are needed
+ *   - The logic func must return a pointer (or a slice of pointers with HandleList), which is what jsonapi requires
+ *
+ * Use NoInput as the input type for endpoints that don't read a body
+ * Use RequestFromContext(ctx) to get the request in the logic func (ex: for mux.Vars)
+ * *******************************************/
+
+// Input type for handlers that don't read the request body-- preprocessing is skipped entirely
+type NoInput struct{}
+
+func (NoInput) Validate() error { return nil }
+
+// Constrains PIn to be a pointer to In that implements InputObject
+// so that the InputObject can have either a value or a pointer receiver for Validate()
+type inputPointer[In any] interface {
+	*In
+	InputObject
+}
+
+type handlerConfig struct {
+	maxBytes       int
+	preprocessFunc func(InputObject, int, http.ResponseWriter, *http.Request) error
+	responseFunc   func(interface{}, int, http.ResponseWriter, *http.Request) error
+	logError       func(error, *http.Request)
+}
+
+type HandlerOption func(*handlerConfig)
+
+// Max bytes of the body to read (see PreProcessInput)
+func WithMaxBytes(maxBytes int) HandlerOption {
+	return func(c *handlerConfig) { c.maxBytes = maxBytes }
+}
+
+// Only read and write json, regardless of the request headers (like StandardJSONRequestHandler)
+// By default, the handlers use the headers to pick json or jsonapi (like StandardAgnosticRequestHandler)
+func WithJSONOnly() HandlerOption {
+	return func(c *handlerConfig) {
+		c.preprocessFunc = PreProcessInputFromJSON
+		c.responseFunc = func(data interface{}, status int, w http.ResponseWriter, r *http.Request) error {
+			if data == nil {
+				w.WriteHeader(status)
+				return nil
+			}
+			return WriteModelToResponseJSON(data, status, w)
+		}
+	}
+}
+
+func WithPreprocessFunc(preprocessFunc func(InputObject, int, http.ResponseWriter, *http.Request) error) HandlerOption {
+	return func(c *handlerConfig) { c.preprocessFunc = preprocessFunc }
+}
+
+func WithResponseFunc(responseFunc func(interface{}, int, http.ResponseWriter, *http.Request) error) HandlerOption {
+	return func(c *handlerConfig) { c.responseFunc = responseFunc }
+}
+
+// By default errors are logged with the request-scoped logger (see logging.FromContext)
+func WithErrorLogger(logError func(error, *http.Request)) HandlerOption {
+	return func(c *handlerConfig) { c.logError = logError }
+}
+
+func newHandlerConfig(opts []HandlerOption) handlerConfig {
+	config := handlerConfig{
+		preprocessFunc: PreProcessInputFromHeaders,
+		responseFunc:   WriteModelToResponseFromHeaders,
+		logError: func(err error, r *http.Request) {
+			logging.FromContext(r.Context()).Error("Error handling request", logging.Fields{logging.FieldError: err})
+		},
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// Returns a handler that reads the input into a new In, calls logicFunc, and writes the output
+// Errors are handled the same way as in StandardRequestHandler
+func Handle[In any, PIn inputPointer[In], Out any](
+	logicFunc func(context.Context, PIn) (*Out, int, error),
+	opts ...HandlerOption,
+) http.HandlerFunc {
+	return handle[In, PIn](func(ctx context.Context, input PIn) (interface{}, int, error) {
+		output, status, err := logicFunc(ctx, input)
+		// A nil *Out in an interface{} is not nil, and would be written as "null" instead of an empty response
+		if output == nil {
+			return nil, status, err
+		}
+		return output, status, err
+	}, opts)
+}
+
+// Same as Handle, but for logic funcs that return a list
+func HandleList[In any, PIn inputPointer[In], Out any](
+	logicFunc func(context.Context, PIn) ([]*Out, int, error),
+	opts ...HandlerOption,
+) http.HandlerFunc {
+	return handle[In, PIn](func(ctx context.Context, input PIn) (interface{}, int, error) {
+		output, status, err := logicFunc(ctx, input)
+		if output == nil {
+			// Lists should be written as [] instead of null
+			output = []*Out{}
+		}
+		return output, status, err
+	}, opts)
+}
+
+func handle[In any, PIn inputPointer[In]](
+	logicFunc func(context.Context, PIn) (interface{}, int, error),
+	opts []HandlerOption,
+) http.HandlerFunc {
+	config := newHandlerConfig(opts)
+	// Fail at startup if the input has a bad validate tag
+	checkValidationTags(reflect.TypeOf(new(In)))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(ContextWithRequest(r.Context(), r))
+		input := PIn(new(In))
+
+		preprocessFunc := config.preprocessFunc
+		if _, isNoInput := InputObject(input).(*NoInput); isNoInput {
+			preprocessFunc = func(InputObject, int, http.ResponseWriter, *http.Request) error { return nil }
+		}
+
+		wrappedLogicFunc := func(i InputObject, r *http.Request) (interface{}, int, error) {
+			return logicFunc(r.Context(), input)
+		}
+		// The error is already logged and written to the response
+		_ = StandardRequestHandler(input, config.maxBytes, preprocessFunc, wrappedLogicFunc, config.responseFunc, w, r, config.logError)
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/Gamma169/go-server-helpers/logging"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultHealthCheckTimeout = 2 * time.Second
+
+const (
+	HealthStatusOK       = "ok"
+	HealthStatusDegraded = "degraded"
+	HealthStatusFail     = "fail"
+)
+
+/*********************************************
+ * Health Checks
+ *
+ * Register checks (ex: db.PostgresHealthCheck and db.RedisHealthCheck) and mount the endpoints
+ *   readiness := server.NewReadiness()
+ *   health := server.NewHealthRegistry(readiness)
+ *   health.Register(server.HealthCheck{Name: "postgres", Check: db.PostgresHealthCheck(dbConn), Critical: true})
+ *   server.AddHealthEndpoints(router, health)
+ *   server.Run(ctx, server.RunConfig{Readiness: readiness, ...})
+ *
+ * /readyz runs every check-- it returns 503 if any critical check fails, or if the service is shutting down
+ * /healthz only runs the checks marked Liveness, so an outage of a dependency doesn't restart every instance
+ * Both return a JSON report with the result of each check
+ * The errors from failed checks are logged, but only sent in the report if DebugErrors is set-- they can have host names, users, etc
+ * *******************************************/
+
+type HealthCheck struct {
+	Name  string
+	Check func(context.Context) error
+	// Defaults to 2 seconds
+	Timeout time.Duration
+	// If a critical check fails the endpoint returns 503, otherwise the report is just marked degraded
+	Critical bool
+	// Also run the check for /healthz
+	Liveness bool
+}
+
+type HealthCheckResult struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Critical   bool    `json:"critical"`
+	DurationMs float64 `json:"durationMs"`
+	Error      string  `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status string              `json:"status"`
+	Ready  *bool               `json:"ready,omitempty"`
+	Checks []HealthCheckResult `json:"checks"`
+}
+
+type HealthRegistry struct {
+	mu        sync.RWMutex
+	checks    []HealthCheck
+	readiness *Readiness
+}
+
+// readiness can be nil if the service doesn't use Run
+func NewHealthRegistry(readiness *Readiness) *HealthRegistry {
+	return &HealthRegistry{readiness: readiness}
+}
+
+func (h *HealthRegistry) Register(check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, check)
+}
+
+// Runs the checks in parallel, each with its own timeout
+func (h *HealthRegistry) Run(ctx context.Context, livenessOnly bool) HealthReport {
+	h.mu.RLock()
+	checks := []HealthCheck{}
+	for _, check := range h.checks {
+		if !livenessOnly || check.Liveness {
+			checks = append(checks, check)
+		}
+	}
+	h.mu.RUnlock()
+
+	report := HealthReport{Status: HealthStatusOK, Checks: make([]HealthCheckResult, len(checks))}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check HealthCheck) {
+			defer wg.Done()
+			report.Checks[i] = runHealthCheck(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status == HealthStatusOK {
+			continue
+		}
+		if result.Critical {
+			report.Status = HealthStatusFail
+		} else if report.Status == HealthStatusOK {
+			report.Status = HealthStatusDegraded
+		}
+	}
+	return report
+}
+
+func runHealthCheck(ctx context.Context, check HealthCheck) HealthCheckResult {
+	timeout := check.Timeout
+	if timeout == 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check.Check(ctx) }()
+
+	var err error
+	publicErr := "check failed"
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = errors.New("timed out after " + timeout.String())
+		publicErr = "timeout"
+	}
+
+	result := HealthCheckResult{
+		Name:       check.Name,
+		Status:     HealthStatusOK,
+		Critical:   check.Critical,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		logging.FromContext(ctx).Warn("Health check failed", logging.Fields{"check": check.Name, logging.FieldError: err})
+		result.Status = HealthStatusFail
+		result.Error = publicErr
+		if DebugErrors {
+			result.Error = err.Error()
+		}
+	}
+	return result
+}
+
+func (h *HealthRegistry) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	report := h.Run(r.Context(), true)
+	writeHealthReport(report, w)
+}
+
+func (h *HealthRegistry) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	report := h.Run(r.Context(), false)
+	if h.readiness != nil {
+		ready := h.readiness.IsReady()
+		report.Ready = &ready
+		if !ready {
+			report.Status = HealthStatusFail
+		}
+	}
+	writeHealthReport(report, w)
+}
+
+func writeHealthReport(report HealthReport, w http.ResponseWriter) {
+	status := http.StatusOK
+	if report.Status == HealthStatusFail {
+		status = http.StatusServiceUnavailable
+	}
+	// Health reports should never be cached by proxies
+	w.Header().Set("Cache-Control", "no-store")
+	// Nothing more can be done if writing fails
+	_ = WriteModelToResponseJSON(report, status, w)
+}
+
+// Mounts GET /healthz and /readyz on the router
+func AddHealthEndpoints(router *mux.Router, registry *HealthRegistry) {
+	router.Path("/healthz").Methods(http.MethodGet).HandlerFunc(registry.LivenessHandler)
+	router.Path("/readyz").Methods(http.MethodGet).HandlerFunc(registry.ReadinessHandler)
+}
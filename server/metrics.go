@@ -0,0 +1,43 @@
+package server
+
+import (
+	"github.com/Gamma169/go-server-helpers/metrics"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// Records http_requests_total and the http_request_duration_seconds histogram (labeled by route, method and status)
+// and the http_requests_in_flight gauge (labeled by route and method)
+// The route label is the mux route template, not the raw URI, so ids in paths don't blow up the number of series
+func AddMetricsMiddleware(router *mux.Router, registry *metrics.Registry) {
+	requests := registry.NewCounter("http_requests_total", "Total number of HTTP requests handled.", "route", "method", "status")
+	duration := registry.NewHistogram("http_request_duration_seconds", "Duration of HTTP requests in seconds.", nil, "route", "method", "status")
+	inFlight := registry.NewGauge("http_requests_in_flight", "Number of HTTP requests currently being handled.", "route", "method")
+
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := "unknown"
+			if currentRoute := mux.CurrentRoute(r); currentRoute != nil {
+				if tmpl, err := currentRoute.GetPathTemplate(); err == nil {
+					route = tmpl
+				}
+			}
+
+			inFlight.Inc(route, r.Method)
+			defer inFlight.Dec(route, r.Method)
+
+			wrapped := NewWrappedResponseWriter(w)
+			next.ServeHTTP(wrapped, r)
+
+			status := strconv.Itoa(wrapped.Status())
+			requests.Inc(route, r.Method, status)
+			duration.Observe(wrapped.Duration().Seconds(), route, r.Method, status)
+		})
+	})
+}
+
+// Mounts GET /metrics on the router in the Prometheus text format
+func AddMetricsEndpoint(router *mux.Router, registry *metrics.Registry) {
+	router.Path("/metrics").Methods(http.MethodGet).Handler(registry.Handler())
+}
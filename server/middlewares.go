@@ -1,32 +1,22 @@
 package server
 
 import (
+	"github.com/Gamma169/go-server-helpers/logging"
+	"github.com/Gamma169/go-server-helpers/tracing"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"log"
 	"net/http"
 )
 
-const boldPrint = "\033[1m"
-const headerPrint = "\033[95m"
-const endPrint = "\033[0m"
-
 // This adds CORS headers for all requests (to use if web server is running locally)
+// Allows any origin without credentials-- use AddCORSMiddlewareAndEndpointWithConfig to restrict origins or allow credentials
 func AddCORSMiddlewareAndEndpoint(router *mux.Router, requesterIdHeader string) {
-	router.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, Session, "+requesterIdHeader)
-			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
-			next.ServeHTTP(w, r)
-		})
-	})
-	// Any options requests return 204-- to be used with above CORS stuff
-	router.PathPrefix("/").Methods(http.MethodOptions).HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	AddCORSMiddlewareAndEndpointWithConfig(router, DefaultCORSConfig(requesterIdHeader))
 }
 
 // Check if the requesterIdHeader exists and is valid and return 400 if not
+// The parsed id is stored in the request context-- get it with RequesterIDFromContext
+// Add this after AddLoggingMiddleware in order to get the requester id in the request logs
 func AddRequesterIdHeaderMiddleware(router *mux.Router, requesterIdHeader string, debug bool) {
 	router.Use(
 		func(next http.Handler) http.Handler {
@@ -36,46 +26,103 @@ func AddRequesterIdHeaderMiddleware(router *mux.Router, requesterIdHeader string
 				if requesterId == "" {
 					msg := "No '" + requesterIdHeader + "' header"
 					if debug {
-						log.Println(msg)
+						logging.FromContext(r.Context()).Debug(msg)
 					}
-					http.Error(w, msg, http.StatusBadRequest)
+					_ = WriteError(NewAPIError(http.StatusBadRequest, "invalid_requester_id", msg), w, r)
 					return
 				}
-				if _, err := uuid.Parse(requesterId); err != nil {
+				parsedId, err := uuid.Parse(requesterId)
+				if err != nil {
 					msg := requesterIdHeader + "- is not valid UUID"
 					if debug {
-						log.Println(msg)
+						logging.FromContext(r.Context()).Debug(msg)
 					}
-					http.Error(w, msg, http.StatusBadRequest)
+					_ = WriteError(NewAPIError(http.StatusBadRequest, "invalid_requester_id", msg), w, r)
 					return
 				}
+				logging.AddFields(r.Context(), logging.Fields{logging.FieldRequesterId: requesterId})
 
 				// Call the next handler, which can be another middleware in the chain, or the final handler.
-				next.ServeHTTP(w, r)
+				// Handlers can get the id with RequesterIDFromContext
+				next.ServeHTTP(w, r.WithContext(ContextWithRequesterID(r.Context(), parsedId)))
 			})
 		},
 	)
 }
 
+// Logs every request with the default logger (see logging package) and adds a request-scoped logger to the request context
+// The trace id header is echoed in the response headers as is, and a new trace id is generated if the request has none
+// It is also stored in the request context if it is a UUID-- get it with TraceIDFromContext
+// Use `logging.FromContext(r.Context())` in handlers to log with the request's trace id (and requester id if AddRequesterIdHeaderMiddleware is used)
+// The "Received" line is only logged if debug is true
+// The "Finished" line is always logged-- as an error for 5xx, a warning for 4xx, and info otherwise
 func AddLoggingMiddleware(router *mux.Router, traceIdHeader string, debug bool) {
+	AddLoggingMiddlewareWithLogger(router, nil, traceIdHeader, debug)
+}
+
+// Same as AddLoggingMiddleware but logs with logger instead of the default logger (nil uses the default logger)
+func AddLoggingMiddlewareWithLogger(router *mux.Router, logger logging.Logger, traceIdHeader string, debug bool) {
 	router.Use(
 		func(next http.Handler) http.Handler {
 			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Keep the caller's trace id as is so it matches their own logs
+				// Only when there is none use the span's trace id (from AddTracingMiddleware or the W3C traceparent header) or a new one
 				requestId := r.Header.Get(traceIdHeader)
+				traceId, hasTraceId := TraceIDFromContext(r.Context())
+				if !hasTraceId {
+					if requestId != "" {
+						traceId, hasTraceId = parseTraceId(requestId)
+					} else if sc := tracing.SpanContextFromContext(tracing.Extract(r.Context(), r.Header)); sc.TraceID.IsValid() {
+						traceId, hasTraceId = uuid.UUID(sc.TraceID), true
+					} else {
+						traceId, hasTraceId = uuid.New(), true
+					}
+				}
 				if requestId == "" {
-					requestId = uuid.New().String()
+					requestId = traceId.String()
 					r.Header.Set(traceIdHeader, requestId)
 				}
+				// Echo the trace id so clients can reference it when reporting issues
+				w.Header().Set(traceIdHeader, requestId)
 
-				if debug {
-					log.Println(boldPrint, headerPrint, "Received:", r.RequestURI, "--", requestId, endPrint)
+				fields := logging.Fields{
+					logging.FieldTraceId: requestId,
+					logging.FieldMethod:  r.Method,
+					logging.FieldURI:     r.RequestURI,
 				}
-				next.ServeHTTP(w, r)
-				// TODO: Prob implement custom responseWriter to be able to get status from request
-				// https://github.com/Gamma169/go-service-template/issues/2
+				if route := mux.CurrentRoute(r); route != nil {
+					if tmpl, err := route.GetPathTemplate(); err == nil {
+						fields[logging.FieldRoute] = tmpl
+					}
+				}
+				if span := tracing.SpanFromContext(r.Context()); span != nil {
+					fields[logging.FieldSpanId] = span.SpanContext().SpanID.String()
+				}
+				ctx := r.Context()
+				if hasTraceId {
+					ctx = ContextWithTraceID(ctx, traceId)
+				}
+				ctx = logging.NewContext(ctx, logging.OrDefault(logger), fields)
+				r = r.WithContext(ctx)
+
 				if debug {
-					log.Println(boldPrint, headerPrint, "Finished:", r.RequestURI, "--", requestId, "--", "[]", endPrint)
+					logging.FromContext(ctx).Debug("Received request")
+				}
+				wrapped := NewWrappedResponseWriter(w)
+				next.ServeHTTP(wrapped, r)
+
+				level := logging.LevelInfo
+				if wrapped.Status() >= 500 {
+					level = logging.LevelError
+				} else if wrapped.Status() >= 400 {
+					level = logging.LevelWarn
 				}
+				logging.FromContext(ctx).Log(level, "Finished request", logging.Fields{
+					logging.FieldStatus:   wrapped.Status(),
+					logging.FieldSize:     wrapped.BytesWritten(),
+					logging.FieldDuration: wrapped.Duration(),
+					"ttfb":                wrapped.TimeToFirstByte(),
+				})
 			})
 		},
 	)
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"github.com/Gamma169/go-server-helpers/logging"
+	"github.com/Gamma169/go-server-helpers/tracing"
+	"github.com/gorilla/mux"
+	"net/http"
+	"runtime/debug"
+)
+
+// Called with every recovered panic (ex: to send it to an error reporting service)
+// err is the panic value (wrapped in an error if it wasn't one) and stack is the stack trace of the panicking goroutine
+type PanicReporter func(r *http.Request, err error, stack []byte)
+
+// Recovers panics in handlers, logs them with the stack trace, and responds with a 500
+// in the same format as WriteError (the detail is only sent if DebugErrors is set)
+// If the handler already started writing the response, the 500 can't be sent, so after it is logged and reported
+// the middleware panics with http.ErrAbortHandler-- the http.Server then drops the connection so the client can't mistake the partial response for a complete one
+//
+// Panics with http.ErrAbortHandler are re-panicked-- that is how handlers tell the http.Server to abort the response silently
+// reporter can be nil
+//
+// Add this after AddLoggingMiddleware so that the panic is logged with the trace id and the request is logged as a 500
+func AddRecoveryMiddleware(router *mux.Router, reporter PanicReporter) {
+	router.Use(
+		func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				wrapped := NewWrappedResponseWriter(w)
+				defer func() {
+					recovered := recover()
+					if recovered == nil {
+						return
+					}
+					if recovered == http.ErrAbortHandler {
+						panic(recovered)
+					}
+
+					stack := debug.Stack()
+					err, ok := recovered.(error)
+					if !ok {
+						err = fmt.Errorf("panic: %v", recovered)
+					}
+
+					fields := logging.Fields{
+						logging.FieldError: err,
+						"stack":            string(stack),
+					}
+					// Already in the logger's fields with AddLoggingMiddleware, but not if only AddTracingMiddleware is used
+					if traceId, ok := TraceIDFromContext(r.Context()); ok {
+						fields[logging.FieldTraceId] = traceId.String()
+					}
+					logging.FromContext(r.Context()).Error("Recovered from panic", fields)
+					if span := tracing.SpanFromContext(r.Context()); span != nil {
+						span.RecordError(err)
+					}
+					if reporter != nil {
+						reporter(r, err, stack)
+					}
+
+					if wrapped.WroteHeader() {
+						panic(http.ErrAbortHandler)
+					}
+					apiErr := NewAPIError(http.StatusInternalServerError, "internal_error", "")
+					if DebugErrors {
+						apiErr.Detail = err.Error()
+					}
+					apiErr.Err = err
+					if writeErr := WriteError(apiErr, wrapped, r); writeErr != nil {
+						logging.FromContext(r.Context()).Warn("Could not write error response", logging.Fields{logging.FieldError: writeErr})
+					}
+				}()
+				next.ServeHTTP(wrapped, r)
+			})
+		},
+	)
+}
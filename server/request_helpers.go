@@ -21,6 +21,8 @@ type InputObject interface {
  * *******************************************/
 
 // Be sure to pass in pointer to InputObject
+// Checks the `validate` struct tags (see validation.go) and then calls the InputObject's Validate()
+// Validate() is only called if the tags pass, so it can rely on them (ex: that a required pointer is not nil)
 // Usage:  PreProcessInput(&model, 500, w, r, fn)
 func PreProcessInput(inputPtr InputObject, maxBytes int, w http.ResponseWriter, r *http.Request, unmarshalFn func(interface{}, *http.Request) error) error {
 	if inputPtr == nil {
@@ -37,6 +39,10 @@ func PreProcessInput(inputPtr InputObject, maxBytes int, w http.ResponseWriter,
 		return err
 	}
 
+	if tagErrs := ValidateStruct(inputPtr); tagErrs != nil {
+		return tagErrs
+	}
+	// Validate() can return ValidationErrors too, to get the same 422 response as the tags
 	return inputPtr.Validate()
 }
 
@@ -84,10 +90,13 @@ func UnmarshalObjectFromJSONStrict(inputPtr interface{}, r *http.Request) error
  * Error Handling
  * *******************************************/
 
+// Logs the error and writes it to the response as an APIError (see WrapError for how plain errors are converted)
+// The original error is passed to logError, so internal details are still logged even if they are masked in the response
 func SendErrorOnError(err error, status int, w http.ResponseWriter, r *http.Request, logError func(error, *http.Request)) {
 	if err != nil {
 		logError(err, r)
-		http.Error(w, err.Error(), status)
+		// Nothing more can be done if writing the error fails-- the status has already been written
+		_ = WriteError(WrapError(err, status), w, r)
 	}
 }
 
@@ -114,10 +123,11 @@ func SendErrorOnError(err error, status int, w http.ResponseWriter, r *http.Requ
  * (useful for json handler that outputs json but doesn't require input)
  * *******************************************/
 
-// Note that preprocessFunc returns a 400 Bad Request on ANY error
+// Note that preprocessFunc returns a 400 Bad Request on ANY error that is not an APIError
 // So try to make sure that any errors the function returns are actual bad user input errors
 // and not any other kind of logical error (ex, a failed http request in the func *should* probably return 500, but will not)
-// If you REALLY want to control the error, use an empty `preprocessFunc` and put everything in the `logicFunc`
+// If you REALLY want to control the error, return an APIError, or use an empty `preprocessFunc` and put everything in the `logicFunc`
+// Errors are written as problem+json (or JSON:API errors if negotiated)-- see SendErrorOnError
 // NOTE: logicFunc should return a POINTER to your struct instead of the struct or else things might not work right-- see comment in code
 func StandardRequestHandler(
 	inputPtr InputObject,
@@ -206,14 +216,16 @@ func WriteModelToResponseFromHeaders(dataToSend interface{}, status int, w http.
 		w.WriteHeader(status)
 		return nil
 	}
-	header := r.Header.Get(ContentTypeHeader)
-	acceptHeader := r.Header.Get(AcceptContentTypeHeader)
-	if header == jsonapi.MediaType || acceptHeader == jsonapi.MediaType {
+	if requestWantsJSONAPI(r) {
 		return WriteModelToResponseJSONAPI(dataToSend, status, w)
 	}
 	return WriteModelToResponseJSON(dataToSend, status, w)
 }
 
+func requestWantsJSONAPI(r *http.Request) bool {
+	return r.Header.Get(ContentTypeHeader) == jsonapi.MediaType || r.Header.Get(AcceptContentTypeHeader) == jsonapi.MediaType
+}
+
 // Convenience function so you don't have to write your own wrapper function if you don't want to return NoContent
 func WriteNoContentToResponse(dataToSend interface{}, status int, w http.ResponseWriter, r *http.Request) error {
 	w.WriteHeader(http.StatusNoContent)
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// WrappedResponseWriter wraps an http.ResponseWriter and records what was written to it
+// so that middlewares (like the logging middleware) can inspect the response after the handler has run
+//
+// It still implements http.Flusher, http.Hijacker and http.Pusher
+// If the underlying ResponseWriter does not support one of them, the call is a no-op (Flush)
+// or returns an error (Hijack and Push) instead of panicking
+type WrappedResponseWriter struct {
+	http.ResponseWriter
+
+	status       int
+	bytesWritten int
+	wroteHeader  bool
+	start        time.Time
+	firstByte    time.Time
+}
+
+func NewWrappedResponseWriter(w http.ResponseWriter) *WrappedResponseWriter {
+	return &WrappedResponseWriter{
+		ResponseWriter: w,
+		start:          time.Now(),
+	}
+}
+
+// Informational statuses (ex: 103 Early Hints) are passed through but not recorded-- the final status comes after them
+// 101 Switching Protocols is final, like in net/http
+func (w *WrappedResponseWriter) WriteHeader(status int) {
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+		w.firstByte = time.Now()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *WrappedResponseWriter) Write(b []byte) (int, error) {
+	// Mirrors the standard library-- the first Write without a WriteHeader sends a 200
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytesWritten += n
+	return n, err
+}
+
+// Returns the status written to the response
+// If the handler never wrote anything, the server will respond with 200, so that is what is returned
+func (w *WrappedResponseWriter) Status() int {
+	if !w.wroteHeader {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Returns true once the status has been sent-- after that the response can no longer be changed
+func (w *WrappedResponseWriter) WroteHeader() bool {
+	return w.wroteHeader
+}
+
+func (w *WrappedResponseWriter) BytesWritten() int {
+	return w.bytesWritten
+}
+
+// Returns the time from when the writer was created until the header was written
+// Returns 0 if nothing has been written yet
+func (w *WrappedResponseWriter) TimeToFirstByte() time.Duration {
+	if !w.wroteHeader {
+		return 0
+	}
+	return w.firstByte.Sub(w.start)
+}
+
+// Returns the time since the writer was created
+func (w *WrappedResponseWriter) Duration() time.Duration {
+	return time.Since(w.start)
+}
+
+// Allows http.ResponseController (go 1.20+) to reach the original ResponseWriter
+func (w *WrappedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *WrappedResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		if !w.wroteHeader {
+			w.WriteHeader(http.StatusOK)
+		}
+		flusher.Flush()
+	}
+}
+
+func (w *WrappedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("underlying ResponseWriter does not implement http.Hijacker")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && !w.wroteHeader {
+		// The connection belongs to the caller now, so mark it as switching protocols for the logs
+		w.status = http.StatusSwitchingProtocols
+		w.wroteHeader = true
+		w.firstByte = time.Now()
+	}
+	return conn, rw, err
+}
+
+func (w *WrappedResponseWriter) Push(target string, opts *http.PushOptions) error {
+	pusher, ok := w.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, opts)
+}
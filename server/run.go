@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Gamma169/go-server-helpers/logging"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const defaultShutdownTimeout = 15 * time.Second
+const defaultHookTimeout = 10 * time.Second
+
+// Tracks whether the service should receive traffic
+// Run marks it ready once the servers are started, and not ready as soon as shutdown begins
+type Readiness struct {
+	ready int32
+}
+
+func NewReadiness() *Readiness {
+	return &Readiness{}
+}
+
+func (r *Readiness) SetReady(ready bool) {
+	var val int32
+	if ready {
+		val = 1
+	}
+	atomic.StoreInt32(&r.ready, val)
+}
+
+func (r *Readiness) IsReady() bool {
+	return atomic.LoadInt32(&r.ready) == 1
+}
+
+// A function run after the servers have shut down (ex: closing DB connections)
+// The context passed to Fn is cancelled after Timeout (defaults to 10 seconds)
+// A negative Timeout waits for Fn to return, however long it takes
+type ShutdownHook struct {
+	Name    string
+	Timeout time.Duration
+	Fn      func(context.Context) error
+}
+
+type RunConfig struct {
+	Servers []*http.Server
+	// Optional-- pass the same one to the health endpoints so readiness fails during shutdown
+	Readiness *Readiness
+	// How long to wait after marking not-ready before shutting down the servers
+	// Gives load balancers (ex: kubernetes) time to stop sending new requests
+	DrainPeriod time.Duration
+	// How long to wait for in-flight requests to finish (defaults to 15 seconds)
+	ShutdownTimeout time.Duration
+	// Run in order after the servers shut down
+	Hooks []ShutdownHook
+	// Signals that start the shutdown (defaults to SIGINT and SIGTERM)
+	Signals []os.Signal
+	// Defaults to logging.Default()
+	Logger logging.Logger
+}
+
+// Every error that happened while running or shutting down
+type RunErrors []error
+
+func (e RunErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Returns true if any of the errors matches target
+func (e RunErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Starts the servers and blocks until ctx is cancelled, a shutdown signal is received, or a server fails
+
+	Then it shuts down in order:
+		1. Marks the service as not ready
+		2. Waits for the DrainPeriod
+		3. Shuts down all the servers in parallel (waiting up to ShutdownTimeout for in-flight requests)
+		4. Runs the shutdown hooks in order, each with its own timeout
+
+	Returns nil on a clean shutdown, otherwise RunErrors with every error that happened along the way
+	If a server cannot listen on its address, the error is returned right away without running the shutdown
+	It never calls os.Exit, so deferred functions in the caller will run
+*/
+func Run(ctx context.Context, config RunConfig) error {
+	signals := config.Signals
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ctx, stop := signal.NotifyContext(ctx, signals...)
+	defer stop()
+	logger := logging.OrDefault(config.Logger)
+
+	// Bind every server before marking ready so that a port already in use is returned right away
+	serveErrs := make(chan error, len(config.Servers))
+	for i, server := range config.Servers {
+		serverErrs, err := ListenAndServe(server)
+		if err != nil {
+			for _, started := range config.Servers[:i] {
+				started.Close()
+			}
+			return RunErrors{fmt.Errorf("server %s: %w", server.Addr, err)}
+		}
+		logger.Info("Server started -- Ready to accept connections", logging.Fields{"addr": server.Addr})
+
+		go func(server *http.Server) {
+			for err := range serverErrs {
+				serveErrs <- fmt.Errorf("server %s: %w", server.Addr, err)
+			}
+		}(server)
+	}
+	if config.Readiness != nil {
+		config.Readiness.SetReady(true)
+	}
+
+	var errs RunErrors
+	select {
+	case <-ctx.Done():
+		logger.Info("Received shutdown signal")
+	case err := <-serveErrs:
+		logger.Error("Server failed-- shutting down", logging.Fields{logging.FieldError: err})
+		errs = append(errs, err)
+	}
+	// Stop catching signals so a second Ctrl+C kills the process if shutdown hangs
+	stop()
+
+	errs = append(errs, shutdown(config)...)
+	logger.Info("Completed shutdown sequence.  Thank you and goodnight.  <(_ _)>")
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func shutdown(config RunConfig) (errs RunErrors) {
+	logger := logging.OrDefault(config.Logger)
+	if config.Readiness != nil {
+		config.Readiness.SetReady(false)
+	}
+	if config.DrainPeriod > 0 {
+		logger.Info(fmt.Sprintf("Draining for %s before shutting down", config.DrainPeriod))
+		time.Sleep(config.DrainPeriod)
+	}
+
+	timeout := config.ShutdownTimeout
+	if timeout == 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	logger.Info("Shutting Down Servers")
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, server := range config.Servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			// Doesn't block if no connections, but will otherwise wait until the timeout deadline
+			if err := server.Shutdown(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("shutting down server %s: %w", server.Addr, err))
+				mu.Unlock()
+			}
+		}(server)
+	}
+	wg.Wait()
+
+	for _, hook := range config.Hooks {
+		if err := runShutdownHook(hook); err != nil {
+			logger.Error("Shutdown hook failed", logging.Fields{"hook": hook.Name, logging.FieldError: err})
+			errs = append(errs, fmt.Errorf("shutdown hook %s: %w", hook.Name, err))
+		}
+	}
+	return
+}
+
+// Does not wait for hooks that ignore their context past the timeout-- they are left running so shutdown can finish
+func runShutdownHook(hook ShutdownHook) error {
+	if hook.Timeout < 0 {
+		return hook.Fn(context.Background())
+	}
+	timeout := hook.Timeout
+	if timeout == 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- hook.Fn(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -3,67 +3,75 @@ package server
 import (
 	"context"
 	"fmt"
+	"github.com/Gamma169/go-server-helpers/logging"
 	"github.com/gorilla/mux"
-	"log"
+	"net"
 	"net/http"
-	"os"
-	"os/signal"
 	"strings"
 	"time"
 )
 
-func CreateAndRunServerFromRouter(router *mux.Router, port string, timeoutTime time.Duration, debug bool) http.Server {
-	server := http.Server{
+func NewServerFromRouter(router *mux.Router, port string, timeoutTime time.Duration) *http.Server {
+	return &http.Server{
 		Handler:      router,
 		Addr:         fmt.Sprintf("0.0.0.0:%s", port),
 		WriteTimeout: timeoutTime,
 		ReadTimeout:  timeoutTime,
 	}
+}
 
-	// This should be 'log' so that we have at least one line printed when the server starts in production mode
-	log.Println("Server started -- Ready to accept connections")
-
-	if debug {
-		log.Println(fmt.Sprintf("Listening on port: %s", port))
-		WalkRouter(router)
+// Binds the listener synchronously (so errors like the port already being in use are returned right away)
+// and then serves in a goroutine
+// The server's Addr is updated to the address actually bound (useful with port "0")
+// The returned channel receives any error from serving (other than http.ErrServerClosed) and is closed once the server stops
+func ListenAndServe(server *http.Server) (<-chan error, error) {
+	addr := server.Addr
+	if addr == "" {
+		addr = ":http"
 	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	server.Addr = listener.Addr().String()
 
-	// Run our server in a goroutine so that it doesn't block.
+	serveErrs := make(chan error, 1)
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			panic(err)
+		defer close(serveErrs)
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			serveErrs <- err
 		}
 	}()
-
-	return server
+	return serveErrs, nil
 }
 
-func SetupAndRunServer(router *mux.Router, port string, debug bool, shutdown func()) {
+// Returns an error if the server cannot listen on the port
+// Errors that happen later while serving are sent on the returned channel
+func CreateAndRunServerFromRouter(router *mux.Router, port string, timeoutTime time.Duration, debug bool) (*http.Server, <-chan error, error) {
+	server := NewServerFromRouter(router, port, timeoutTime)
+
+	serveErrs, err := ListenAndServe(server)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// This should be Info so that we have at least one line printed when the server starts in production mode
+	logging.Default().Info("Server started -- Ready to accept connections", logging.Fields{"addr": server.Addr})
 
-	server := CreateAndRunServerFromRouter(router, port, 5*time.Minute, debug)
-
-	// Graceful shutdown procedure taken from example:
-	// https://github.com/gorilla/mux#graceful-shutdown
-	c := make(chan os.Signal, 1)
-	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
-	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-	signal.Notify(c, os.Interrupt)
-	// Block until we receive our signal.
-	<-c
-	// Create a deadline to wait for.
-	var waitTime = time.Second * 15
 	if debug {
-		waitTime = time.Millisecond * 500
+		logging.Default().Debug(fmt.Sprintf("Listening on: %s", server.Addr))
+		WalkRouter(router)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), waitTime)
-	defer cancel()
-	log.Println("Shutting Down Server")
-	// Doesn't block if no connections, but will otherwise wait
-	// until the timeout deadline.
-	server.Shutdown(ctx)
-	shutdown()
-	log.Println("Completed shutdown sequence.  Thank you and goodnight.  <(_ _)>")
-	os.Exit(0)
+
+	return server, serveErrs, nil
+}
+
+// Runs the server until SIGINT or SIGTERM and then shuts down gracefully (see Run)
+// Returns once shutdown is complete-- it does NOT call os.Exit, so the program exits when main returns
+// Panics if a server fails (ex: the port is in use)
+// shutdown is run after the servers stop and always runs to completion (it has no timeout)
+func SetupAndRunServer(router *mux.Router, port string, debug bool, shutdown func()) {
+	SetupAndRunMultipleServers([]*mux.Router{router}, []string{port}, debug, shutdown)
 }
 
 func SetupAndRunMultipleServers(routers []*mux.Router, ports []string, debug bool, shutdown func()) {
@@ -72,35 +80,39 @@ func SetupAndRunMultipleServers(routers []*mux.Router, ports []string, debug boo
 		panic("'routers' and 'ports' provided to 'SetupAndRunMultipleServers' must have same length")
 	}
 
-	servers := []http.Server{}
-
+	servers := []*http.Server{}
 	for i, router := range routers {
-		log.Printf("Starting Server %d (of %d)\n", i+1, len(routers))
-		server := CreateAndRunServerFromRouter(router, ports[i], 5*time.Minute, debug)
-		servers = append(servers, server)
-
+		logging.Default().Info(fmt.Sprintf("Starting Server %d (of %d)", i+1, len(routers)), logging.Fields{"port": ports[i]})
+		if debug {
+			WalkRouter(router)
+		}
+		servers = append(servers, NewServerFromRouter(router, ports[i], 5*time.Minute))
 	}
 
-	// See code comments on single server function to understand what this does
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	<-c
-
+	// Create a deadline to wait for in-flight requests
 	var waitTime = time.Second * 15
 	if debug {
 		waitTime = time.Millisecond * 500
 	}
 
-	log.Println("Shutting Down Servers")
-	for _, server := range servers {
-		ctx, cancel := context.WithTimeout(context.Background(), waitTime)
-		defer cancel()
-		server.Shutdown(ctx)
+	err := Run(context.Background(), RunConfig{
+		Servers:         servers,
+		ShutdownTimeout: waitTime,
+		Hooks: []ShutdownHook{{
+			Name:    "shutdown",
+			Timeout: -1,
+			Fn: func(context.Context) error {
+				shutdown()
+				return nil
+			},
+		}},
+	})
+	// Like before Run existed, a server that can't listen (ex: the port is in use) crashes the program
+	// Use Run to handle the error instead
+	if err != nil {
+		logging.Default().Error("Error running servers", logging.Fields{logging.FieldError: err})
+		panic(err)
 	}
-	shutdown()
-	log.Println("Completed shutdown sequence.  Thank you and goodnight.  <(_ _)>")
-	os.Exit(0)
-
 }
 
 // Print out all route info
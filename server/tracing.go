@@ -0,0 +1,87 @@
+package server
+
+import (
+	"github.com/Gamma169/go-server-helpers/tracing"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// Starts a server span for every request with the default tracer (see tracing.SetDefault)
+// named by the method and mux route template (ex: "GET /users/{id}")
+// The trace is continued from the W3C traceparent header, or else from legacyTraceIdHeader if it has a UUID
+// (a UUID is the same size as a trace id), so clients that only send the old header keep their trace ids
+// Pass an empty legacyTraceIdHeader to only use traceparent
+//
+// Add this before AddLoggingMiddleware so the request logs have the span id
+func AddTracingMiddleware(router *mux.Router, legacyTraceIdHeader string) {
+	router.Use(
+		func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctx := tracing.Extract(r.Context(), r.Header)
+				if !tracing.SpanContextFromContext(ctx).IsValid() {
+					if traceId, ok := legacyTraceId(r, legacyTraceIdHeader); ok {
+						ctx = tracing.ContextWithRemoteSpanContext(ctx, tracing.SpanContext{
+							TraceID: tracing.TraceID(traceId),
+							Flags:   tracing.FlagsSampled,
+							Remote:  true,
+						})
+					}
+				}
+
+				name := r.Method
+				route := ""
+				if currentRoute := mux.CurrentRoute(r); currentRoute != nil {
+					if tmpl, err := currentRoute.GetPathTemplate(); err == nil {
+						route = tmpl
+						name += " " + tmpl
+					}
+				}
+
+				ctx, span := tracing.Default().Start(ctx, name, tracing.SpanKindServer)
+				defer span.End()
+				span.SetAttribute("http.request.method", r.Method)
+				span.SetAttribute("url.path", r.URL.Path)
+				if route != "" {
+					span.SetAttribute("http.route", route)
+				}
+
+				traceId := uuid.UUID(span.SpanContext().TraceID)
+				ctx = ContextWithTraceID(ctx, traceId)
+				// Like AddLoggingMiddleware, a trace id the caller sent is kept as is
+				if legacyTraceIdHeader != "" {
+					if r.Header.Get(legacyTraceIdHeader) == "" {
+						r.Header.Set(legacyTraceIdHeader, traceId.String())
+					}
+					w.Header().Set(legacyTraceIdHeader, r.Header.Get(legacyTraceIdHeader))
+				}
+
+				wrapped := NewWrappedResponseWriter(w)
+				next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+				span.SetAttribute("http.response.status_code", wrapped.Status())
+				// Client errors are not errors of the server span
+				if wrapped.Status() >= 500 {
+					span.SetStatus(tracing.StatusError, http.StatusText(wrapped.Status()))
+				}
+			})
+		},
+	)
+}
+
+// Uses the trace id already set by AddLoggingMiddleware (if it ran first) or else the header
+func legacyTraceId(r *http.Request, legacyTraceIdHeader string) (uuid.UUID, bool) {
+	if traceId, ok := TraceIDFromContext(r.Context()); ok {
+		return traceId, true
+	}
+	if legacyTraceIdHeader == "" {
+		return uuid.UUID{}, false
+	}
+	return parseTraceId(r.Header.Get(legacyTraceIdHeader))
+}
+
+// Trace ids from headers are only used as UUIDs if they are valid (and not all zeros like an invalid span trace id)
+func parseTraceId(value string) (uuid.UUID, bool) {
+	traceId, err := uuid.Parse(value)
+	return traceId, err == nil && traceId != uuid.Nil
+}
@@ -0,0 +1,326 @@
+package server
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+/*********************************************
+ * Struct Tag Validation
+ *
+ * Add a `validate` tag to the fields of an InputObject and PreProcessInput will check them before calling Validate()
+ * (Validate() is only called if the tags pass)
+ * Ex:
+ *   type User struct {
+ *       Id      string    `json:"id"      validate:"required,uuid"`
+ *       Name    string    `json:"name"    validate:"required,min=3,max=64"`
+ *       Email   string    `json:"email"   validate:"omitempty,email"`
+ *       Role    string    `json:"role"    validate:"oneof=admin member"`
+ *       Address *Address  `json:"address" validate:"required"`
+ *       Tags    []string  `json:"tags"    validate:"max=10"`
+ *       Items   []Item    `json:"items"`
+ *   }
+ *
+ * Rules:
+ *   required   - must not be the zero value (or empty for slices and maps, or nil for pointers)
+ *   omitempty  - skip the other rules if the value is the zero value
+ *   uuid       - string must be a valid UUID
+ *   email      - string must be a plain email address (ex: "a@b.com" but not "A <a@b.com>")
+ *   min=N      - length for strings (in characters), slices and maps-- value for numbers
+ *   max=N      - same as min
+ *   oneof=a b  - must be one of the space-separated values
+ *
+ * Nested structs (and pointers to them) and slices of structs are validated too, whether or not they have a tag
+ * Errors are reported with the json path to the field (ex: "items[2].name")
+ * *******************************************/
+
+// Returned by ValidateStruct and PreProcessInput if any field is invalid
+// PreProcessInput (and so the Standard Handlers) turns these into a 422 response with the per-field messages
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, len(v))
+	for i, fieldErr := range v {
+		if fieldErr.Field == "" {
+			msgs[i] = fieldErr.Message
+		} else {
+			msgs[i] = fieldErr.Field + ": " + fieldErr.Message
+		}
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+type validationRule struct {
+	name  string
+	param string
+}
+
+type validatedField struct {
+	index int
+	name  string
+	rules []validationRule
+	// Anonymous embedded struct-- its fields are promoted just like in json
+	embedded bool
+}
+
+// Parsed tags per struct type so that we only parse them once
+var validationCache sync.Map
+
+// Validates the `validate` tags of a struct (or pointer to a struct)
+// Returns nil if everything is valid
+// Panics if a tag has an unknown rule or a bad parameter, since that is a programming error
+// (Handle checks the tags when it is called, so that the panic happens at startup)
+func ValidateStruct(st interface{}) ValidationErrors {
+	var errs ValidationErrors
+	validateValue(reflect.ValueOf(st), "", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Parses the `validate` tags of t and of every struct type it contains, so a bad tag panics when the handler is built
+// instead of on the first request (see Handle)
+func checkValidationTags(t reflect.Type) {
+	checkValidationTagsOf(t, map[reflect.Type]bool{})
+}
+
+func checkValidationTagsOf(t reflect.Type, seen map[reflect.Type]bool) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	// Self-referencing types would loop forever
+	if t.Kind() != reflect.Struct || seen[t] {
+		return
+	}
+	seen[t] = true
+	for _, field := range structValidationFields(t) {
+		checkValidationTagsOf(t.Field(field.index).Type, seen)
+	}
+}
+
+func validateValue(v reflect.Value, path string, errs *ValidationErrors) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		for _, field := range structValidationFields(v.Type()) {
+			fieldVal := v.Field(field.index)
+			fieldPath := joinPath(path, field.name)
+			if field.embedded {
+				fieldPath = path
+			}
+			if applyRules(fieldVal, fieldPath, field.rules, errs) {
+				validateValue(fieldVal, fieldPath, errs)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		elemType := v.Type().Elem()
+		for elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
+		if elemType.Kind() != reflect.Struct {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func structValidationFields(t reflect.Type) []validatedField {
+	if cached, ok := validationCache.Load(t); ok {
+		return cached.([]validatedField)
+	}
+
+	var fields []validatedField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		// Unexported fields cannot be set from the input so there is nothing to validate
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		name := f.Name
+		jsonName := strings.Split(f.Tag.Get("json"), ",")[0]
+		if jsonName == "-" {
+			continue
+		}
+		if jsonName != "" {
+			name = jsonName
+		}
+
+		field := validatedField{
+			index:    i,
+			name:     name,
+			embedded: f.Anonymous && jsonName == "",
+		}
+		if tag := f.Tag.Get("validate"); tag != "" && tag != "-" {
+			field.rules = parseValidationTag(t, f.Name, tag)
+		}
+		fields = append(fields, field)
+	}
+
+	validationCache.Store(t, fields)
+	return fields
+}
+
+func parseValidationTag(t reflect.Type, fieldName string, tag string) []validationRule {
+	var rules []validationRule
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		rule := validationRule{name: part}
+		if i := strings.Index(part, "="); i != -1 {
+			rule.name, rule.param = part[:i], part[i+1:]
+		}
+
+		switch rule.name {
+		case "required", "omitempty", "uuid", "email", "oneof":
+		case "min", "max":
+			if _, err := strconv.ParseFloat(rule.param, 64); err != nil {
+				panic(fmt.Sprintf("validate tag on %s.%s: '%s' needs a number", t.Name(), fieldName, rule.name))
+			}
+		default:
+			panic(fmt.Sprintf("validate tag on %s.%s: unknown rule '%s'", t.Name(), fieldName, rule.name))
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// Returns false if nested validation should be skipped (ex: the field is required and missing)
+func applyRules(v reflect.Value, path string, rules []validationRule, errs *ValidationErrors) bool {
+	isZero := isZeroValue(v)
+	for _, rule := range rules {
+		if rule.name == "omitempty" && isZero {
+			return false
+		}
+	}
+
+	for _, rule := range rules {
+		if rule.name == "required" {
+			if isZero {
+				*errs = append(*errs, FieldError{Field: path, Code: "required", Message: "is required"})
+				return false
+			}
+			continue
+		}
+		if msg := checkRule(v, rule); msg != "" {
+			*errs = append(*errs, FieldError{Field: path, Code: rule.name, Message: msg})
+		}
+	}
+	return true
+}
+
+func isZeroValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Invalid:
+		return true
+	}
+	return v.IsZero()
+}
+
+// Returns the error message, or "" if the value passes the rule
+func checkRule(v reflect.Value, rule validationRule) string {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	switch rule.name {
+	case "uuid":
+		if v.Kind() == reflect.String {
+			if _, err := uuid.Parse(v.String()); err != nil {
+				return "must be a valid UUID"
+			}
+		}
+	case "email":
+		if v.Kind() == reflect.String {
+			addr, err := mail.ParseAddress(v.String())
+			if err != nil || addr.Address != v.String() {
+				return "must be a valid email address"
+			}
+		}
+	case "oneof":
+		options := strings.Fields(rule.param)
+		val := valueString(v)
+		for _, option := range options {
+			if option == val {
+				return ""
+			}
+		}
+		return "must be one of: " + strings.Join(options, ", ")
+	case "min", "max":
+		limit, _ := strconv.ParseFloat(rule.param, 64)
+		size, unit, ok := measure(v)
+		if !ok {
+			return ""
+		}
+		if rule.name == "min" && size < limit {
+			return fmt.Sprintf("must be at least %s%s", rule.param, unit)
+		}
+		if rule.name == "max" && size > limit {
+			return fmt.Sprintf("must be at most %s%s", rule.param, unit)
+		}
+	}
+	return ""
+}
+
+// Not using v.Interface() since it panics for fields promoted from unexported embedded structs
+func valueString(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	}
+	return ""
+}
+
+// Returns the number that min and max compare against, and the unit for the error message
+func measure(v reflect.Value) (float64, string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters long", true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), " items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "", true
+	}
+	return 0, "", false
+}
@@ -1,11 +1,16 @@
 package tests
 
 import (
+	"database/sql"
+	"encoding/hex"
 	"errors"
 	"github.com/Gamma169/go-server-helpers/db"
+	"github.com/google/uuid"
 	"math/rand"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 /*********************************************
@@ -79,6 +84,201 @@ func TestAssignArrayPropertyFromString(t *testing.T) {
 	}
 }
 
+type myIds []uuid.UUID
+
+func TestAssignArrayPropertyFromStringConvertsElements(t *testing.T) {
+	type myStruct struct {
+		Ints    []int
+		Ids     myIds
+		Floats  [2]float64
+		Flags   []*bool
+		private []string
+	}
+	id1, id2 := uuid.New(), uuid.New()
+	trueVal, falseVal := true, false
+
+	testCases := []struct {
+		field     string
+		arrString string
+		expected  interface{}
+		expectErr bool
+	}{
+		{"Ints", "1,2, 3", []int{1, 2, 3}, false},
+		{"Ints", "", []int{}, false},
+		{"Ints", "1,a", nil, true},
+		{"Ids", id1.String() + "," + id2.String(), myIds{id1, id2}, false},
+		{"Ids", "not-a-uuid", nil, true},
+		{"Floats", "1.5,2", [2]float64{1.5, 2}, false},
+		{"Floats", "1.5", nil, true},
+		{"Flags", "t,false", []*bool{&trueVal, &falseVal}, false},
+		{"private", "a", nil, true},
+		{"Missing", "a", nil, true},
+	}
+
+	for _, tc := range testCases {
+		s := myStruct{}
+
+		// FUNCTION TO TEST:
+		err := db.AssignArrayPropertyFromString(&s, tc.field, tc.arrString, ",")
+
+		if tc.expectErr {
+			assert(t, err != nil, "Should return error for %s %q", tc.field, tc.arrString)
+			continue
+		}
+		ok(t, err)
+		equals(t, tc.expected, reflect.ValueOf(s).FieldByName(tc.field).Interface())
+	}
+}
+
+func TestParsePostgresArray(t *testing.T) {
+	str := func(s string) *string { return &s }
+	testCases := []struct {
+		literal   string
+		expected  []*string
+		expectErr bool
+	}{
+		{"{}", []*string{}, false},
+		{"{a,b}", []*string{str("a"), str("b")}, false},
+		{` { a , "b,c" , NULL, null, "NULL" } `, []*string{str("a"), str("b,c"), nil, nil, str("NULL")}, false},
+		{`{"with \"quote\"","back\\slash","",  "  spaces  "}`, []*string{str(`with "quote"`), str(`back\slash`), str(""), str("  spaces  ")}, false},
+		{`{esc\,aped}`, []*string{str("esc,aped")}, false},
+		{"{héllo,wörld}", []*string{str("héllo"), str("wörld")}, false},
+		{"{{1,2},{3,4}}", nil, true},
+		{`{"unterminated}`, nil, true},
+		{"{a,,b}", nil, true},
+		{"{a,}", nil, true},
+		{`{"a"b}`, nil, true},
+		{"a,b", nil, true},
+		{"", nil, true},
+	}
+
+	for _, tc := range testCases {
+		// FUNCTION TO TEST:
+		elems, err := db.ParsePostgresArray(tc.literal)
+
+		if tc.expectErr {
+			assert(t, err != nil, "Should return error for %q", tc.literal)
+			continue
+		}
+		ok(t, err)
+		equals(t, tc.expected, elems)
+	}
+}
+
+func TestAssignArrayPropertyFromPostgresArray(t *testing.T) {
+	type myStruct struct {
+		Tags   []string
+		Scores []*int
+		Names  []sql.NullString
+	}
+	s := myStruct{}
+	one := 1
+
+	// FUNCTIONS TO TEST:
+	ok(t, db.AssignArrayPropertyFromPostgresArray(&s, "Tags", `{a,"b,c"}`))
+	ok(t, db.AssignArrayPropertyFromPostgresArray(&s, "Scores", `{1,NULL}`))
+	ok(t, db.AssignArrayPropertyFromPostgresArray(&s, "Names", `{x,NULL}`))
+	equals(t, []string{"a", "b,c"}, s.Tags)
+	equals(t, []*int{&one, nil}, s.Scores)
+	equals(t, []sql.NullString{{String: "x", Valid: true}, {}}, s.Names)
+
+	err := db.AssignArrayPropertyFromPostgresArray(&s, "Tags", `{a,NULL}`)
+	assert(t, err != nil && strings.Contains(err.Error(), "NULL"), "Should not put NULL in a []string: %v", err)
+}
+
+func TestFormatPostgresArray(t *testing.T) {
+	id := uuid.MustParse("7d3a4f3c-5a4b-4a39-9f0a-3c9b1c8e2a11")
+	one := 1
+
+	// FUNCTION TO TEST:
+	literal, err := db.FormatPostgresArray([]string{"a", "b,c", "", "NULL", `say "hi"`, `back\slash`, "two words", "{x}"})
+	ok(t, err)
+	equals(t, `{a,"b,c","","NULL","say \"hi\"","back\\slash","two words","{x}"}`, literal)
+
+	literal, err = db.FormatPostgresArray([]*int{&one, nil})
+	ok(t, err)
+	equals(t, "{1,NULL}", literal)
+
+	literal, err = db.FormatPostgresArray(myIds{id})
+	ok(t, err)
+	equals(t, "{7d3a4f3c-5a4b-4a39-9f0a-3c9b1c8e2a11}", literal)
+
+	literal, err = db.FormatPostgresArray([]sql.NullString{{String: "x", Valid: true}, {}})
+	ok(t, err)
+	equals(t, "{x,NULL}", literal)
+
+	literal, err = db.FormatPostgresArray([]float64{1.5, 2})
+	ok(t, err)
+	equals(t, "{1.5,2}", literal)
+
+	_, err = db.FormatPostgresArray([]struct{}{{}})
+	assert(t, err != nil, "Should return error for unsupported types")
+
+	// Formatting and parsing gives back the same values
+	values := []string{randString(10), "a,b", `"q"`, `\`, " ", "null"}
+	literal, err = db.FormatPostgresArray(values)
+	ok(t, err)
+	s := struct{ Values []string }{}
+	ok(t, db.AssignArrayPropertyFromPostgresArray(&s, "Values", literal))
+	equals(t, values, s.Values)
+}
+
+func TestPostgresArrayTimestamps(t *testing.T) {
+	s := struct {
+		Times    []time.Time
+		MaybeAts []*time.Time
+	}{}
+
+	// FUNCTION TO TEST:
+	// How postgres writes a timestamptz[] (and a timestamp[] for the last element)
+	ok(t, db.AssignArrayPropertyFromPostgresArray(&s, "Times", `{"2024-01-01 00:00:00+00","2024-06-01 12:30:45.123456+05:30","2024-06-01T12:30:45Z","2024-06-01 12:30:45"}`))
+	equals(t, 4, len(s.Times))
+	expected := []time.Time{
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 6, 1, 7, 0, 45, 123456000, time.UTC),
+		time.Date(2024, 6, 1, 12, 30, 45, 0, time.UTC),
+		time.Date(2024, 6, 1, 12, 30, 45, 0, time.UTC),
+	}
+	for i := range expected {
+		assert(t, expected[i].Equal(s.Times[i]), "Expected %s but got %s", expected[i], s.Times[i])
+	}
+	ok(t, db.AssignArrayPropertyFromPostgresArray(&s, "MaybeAts", `{NULL,"2024-01-01 00:00:00-08"}`))
+	assert(t, s.MaybeAts[0] == nil && s.MaybeAts[1].Equal(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)), "Should parse NULL and offsets: %v", s.MaybeAts)
+
+	err := db.AssignArrayPropertyFromPostgresArray(&s, "Times", `{infinity}`)
+	assert(t, err != nil, "Should return error for timestamps that can't be parsed")
+
+	// Formatting and parsing gives back the same times
+	values := []time.Time{time.Date(2024, 2, 3, 4, 5, 6, 789000000, time.FixedZone("", -3*60*60)), time.Now().Round(time.Microsecond)}
+	literal, err := db.FormatPostgresArray(values)
+	ok(t, err)
+	assert(t, strings.HasPrefix(literal, `{"2024-02-03 04:05:06.789-03:00",`), "Should format like postgres: %s", literal)
+	ok(t, db.AssignArrayPropertyFromPostgresArray(&s, "Times", literal))
+	for i := range values {
+		assert(t, values[i].Equal(s.Times[i]), "Expected %s but got %s", values[i], s.Times[i])
+	}
+}
+
+func TestPostgresArrayBytea(t *testing.T) {
+	s := struct{ Blobs [][]byte }{}
+
+	// FUNCTION TO TEST:
+	// How postgres writes a bytea[]
+	ok(t, db.AssignArrayPropertyFromPostgresArray(&s, "Blobs", `{"\\x0102ff","\\x",NULL}`))
+	equals(t, [][]byte{{1, 2, 255}, {}, nil}, s.Blobs)
+
+	err := db.AssignArrayPropertyFromPostgresArray(&s, "Blobs", `{abc}`)
+	assert(t, err != nil && strings.Contains(err.Error(), "hex"), "Should only accept the hex format: %v", err)
+
+	// Formatting and parsing gives back the same bytes
+	values := [][]byte{[]byte(randString(10)), {0, '"', '\\', ','}, {}, nil}
+	literal, err := db.FormatPostgresArray(values)
+	ok(t, err)
+	equals(t, `{"\\x`+hex.EncodeToString(values[0])+`","\\x00225c2c","\\x",NULL}`, literal)
+	ok(t, db.AssignArrayPropertyFromPostgresArray(&s, "Blobs", literal))
+	equals(t, values, s.Blobs)
+}
+
 func TestCheckStructFieldsForInjection(t *testing.T) {
 
 	type myStruct struct {
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Gamma169/go-server-helpers/server"
+	"github.com/google/jsonapi"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+/*********************************************
+ * Tests
+ * *******************************************/
+
+func TestWrapError(t *testing.T) {
+	errStr := randString(40)
+	testCases := []struct {
+		err            error
+		status         int
+		debug          bool
+		expectedStatus int
+		expectedDetail string
+	}{
+		{errors.New(errStr), http.StatusBadRequest, false, http.StatusBadRequest, errStr},
+		{errors.New(errStr), http.StatusNotFound, true, http.StatusNotFound, errStr},
+		// Internal errors are masked unless debug
+		{errors.New(errStr), http.StatusInternalServerError, false, http.StatusInternalServerError, ""},
+		{errors.New(errStr), http.StatusBadGateway, true, http.StatusBadGateway, errStr},
+		// Non-error statuses become 500
+		{errors.New(errStr), http.StatusOK, false, http.StatusInternalServerError, ""},
+		{errors.New(errStr), 0, false, http.StatusInternalServerError, ""},
+		// APIErrors are passed through as they are, even if wrapped
+		{server.NewAPIError(http.StatusConflict, "conflict", errStr), http.StatusInternalServerError, false, http.StatusConflict, errStr},
+		{fmt.Errorf("wrapped: %w", server.NewAPIError(http.StatusServiceUnavailable, "down", errStr)), http.StatusBadRequest, false, http.StatusServiceUnavailable, errStr},
+	}
+
+	defer func() { server.DebugErrors = false }()
+	for _, tc := range testCases {
+		server.DebugErrors = tc.debug
+		apiErr := server.WrapError(tc.err, tc.status)
+		equals(t, tc.expectedStatus, apiErr.Status)
+		equals(t, tc.expectedDetail, apiErr.Detail)
+		assert(t, errors.Is(tc.err, apiErr) || errors.Is(apiErr, tc.err), "Should be able to get to the original error")
+	}
+}
+
+func TestWriteErrorProblemJSON(t *testing.T) {
+	apiErr := server.NewAPIError(http.StatusUnprocessableEntity, "validation_failed", randString(40))
+	apiErr.Fields = []server.FieldError{{Field: "name", Code: "required", Message: "is required"}}
+
+	path := "/" + randString(25)
+	req, err := http.NewRequest("POST", path, nil)
+	ok(t, err)
+	recorder := httptest.NewRecorder()
+
+	ok(t, server.WriteError(apiErr, recorder, req))
+
+	equals(t, http.StatusUnprocessableEntity, recorder.Code)
+	equals(t, server.ProblemJSONContentType, recorder.Result().Header.Get(server.ContentTypeHeader))
+
+	var problem struct {
+		Type     string              `json:"type"`
+		Title    string              `json:"title"`
+		Status   int                 `json:"status"`
+		Detail   string              `json:"detail"`
+		Instance string              `json:"instance"`
+		Code     string              `json:"code"`
+		Fields   []server.FieldError `json:"fields"`
+	}
+	ok(t, json.NewDecoder(recorder.Result().Body).Decode(&problem))
+	equals(t, "about:blank", problem.Type)
+	equals(t, http.StatusText(http.StatusUnprocessableEntity), problem.Title)
+	equals(t, http.StatusUnprocessableEntity, problem.Status)
+	equals(t, apiErr.Detail, problem.Detail)
+	equals(t, path, problem.Instance)
+	equals(t, "validation_failed", problem.Code)
+	equals(t, apiErr.Fields, problem.Fields)
+}
+
+func TestWriteErrorJSONAPI(t *testing.T) {
+	testCases := []struct {
+		header string
+		fields []server.FieldError
+	}{
+		{server.ContentTypeHeader, nil},
+		{server.AcceptContentTypeHeader, nil},
+		{server.ContentTypeHeader, []server.FieldError{{Field: "name", Message: "is required"}, {Field: "items[0].id", Code: "uuid", Message: "must be a uuid"}}},
+	}
+
+	for _, tc := range testCases {
+		apiErr := server.NewAPIError(http.StatusBadRequest, "bad", randString(40))
+		apiErr.Fields = tc.fields
+
+		req, err := http.NewRequest("POST", "/"+randString(25), nil)
+		ok(t, err)
+		req.Header.Set(tc.header, jsonapi.MediaType)
+		recorder := httptest.NewRecorder()
+
+		ok(t, server.WriteError(apiErr, recorder, req))
+
+		equals(t, http.StatusBadRequest, recorder.Code)
+		equals(t, jsonapi.MediaType, recorder.Result().Header.Get(server.ContentTypeHeader))
+
+		var payload jsonapi.ErrorsPayload
+		ok(t, json.NewDecoder(recorder.Result().Body).Decode(&payload))
+		if len(tc.fields) == 0 {
+			equals(t, 1, len(payload.Errors))
+			equals(t, apiErr.Detail, payload.Errors[0].Detail)
+			equals(t, "bad", payload.Errors[0].Code)
+			equals(t, "400", payload.Errors[0].Status)
+			continue
+		}
+		equals(t, len(tc.fields), len(payload.Errors))
+		for i, fieldErr := range tc.fields {
+			equals(t, fieldErr.Message, payload.Errors[i].Detail)
+			equals(t, fieldErr.Field, (*payload.Errors[i].Meta)["field"])
+		}
+		equals(t, "bad", payload.Errors[0].Code)
+		equals(t, "uuid", payload.Errors[1].Code)
+	}
+}
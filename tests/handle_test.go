@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Gamma169/go-server-helpers/server"
+	"github.com/google/jsonapi"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+/*********************************************
+ * Helpers
+ * *******************************************/
+
+// Validate has a pointer receiver to check Handle works with them
+type handleInput struct {
+	Id   string `json:"id"   jsonapi:"primary,model" validate:"required"`
+	Name string `json:"name" jsonapi:"attr,name"`
+}
+
+func (h *handleInput) Validate() error {
+	if h.Name == "invalid" {
+		return errors.New("name is invalid")
+	}
+	return nil
+}
+
+type handleOutput struct {
+	Id   string `json:"id"   jsonapi:"primary,model"`
+	Name string `json:"name" jsonapi:"attr,name"`
+}
+
+/*********************************************
+ * Tests
+ * *******************************************/
+
+func TestHandle(t *testing.T) {
+	testCases := []struct {
+		header         string
+		fmtStr         string
+		name           string
+		expectedStatus int
+	}{
+		{server.JSONContentType, jsonFmt, randString(30), http.StatusCreated},
+		{jsonapi.MediaType, jsonapiFmt, randString(30), http.StatusCreated},
+		{server.JSONContentType, jsonFmt, "invalid", http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		id := uuid.New().String()
+		// FUNCTION TO TEST:
+		handler := server.Handle(func(ctx context.Context, input *handleInput) (*handleOutput, int, error) {
+			return &handleOutput{Id: input.Id + "_returned", Name: input.Name + "_returned"}, http.StatusCreated, nil
+		})
+
+		req, err := http.NewRequest("POST", "/"+randString(25), strings.NewReader(fmt.Sprintf(tc.fmtStr, id, tc.name)))
+		ok(t, err)
+		req.Header.Set(server.ContentTypeHeader, tc.header)
+		recorder := httptest.NewRecorder()
+		handler(recorder, req)
+
+		equals(t, tc.expectedStatus, recorder.Code)
+		if tc.expectedStatus != http.StatusCreated {
+			continue
+		}
+		equals(t, tc.header, recorder.Result().Header.Get(server.ContentTypeHeader))
+
+		expectedBodyStr := fmt.Sprintf(tc.fmtStr, id+"_returned", tc.name+"_returned")
+		expectedBodyStr = strings.ReplaceAll(expectedBodyStr, " ", "")
+		expectedBodyStr = strings.ReplaceAll(expectedBodyStr, "\n", "")
+		expectedBodyStr = strings.ReplaceAll(expectedBodyStr, "\t", "")
+		equals(t, expectedBodyStr, recorder.Body.String())
+	}
+}
+
+func TestHandleAllocatesInputPerRequest(t *testing.T) {
+	seen := sync.Map{}
+	handler := server.Handle(func(ctx context.Context, input *handleInput) (*handleOutput, int, error) {
+		_, loaded := seen.LoadOrStore(input, true)
+		if loaded {
+			return nil, http.StatusInternalServerError, errors.New("input was reused")
+		}
+		return &handleOutput{Id: input.Id, Name: input.Name}, http.StatusOK, nil
+	}, server.WithJSONOnly())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := uuid.New().String()
+			req := httptest.NewRequest("POST", "/", strings.NewReader(fmt.Sprintf(jsonFmt, id, "name")))
+			recorder := httptest.NewRecorder()
+			handler(recorder, req)
+
+			var output handleOutput
+			if recorder.Code != http.StatusOK || json.Unmarshal(recorder.Body.Bytes(), &output) != nil || output.Id != id {
+				t.Errorf("Request got the wrong output: %d %s", recorder.Code, recorder.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestHandleNoInputAndErrors(t *testing.T) {
+	errStr := randString(30)
+	router := mux.NewRouter()
+	router.Path("/things/{id}").HandlerFunc(server.Handle(func(ctx context.Context, _ *server.NoInput) (*handleOutput, int, error) {
+		id := mux.Vars(server.RequestFromContext(ctx))["id"]
+		if id == "missing" {
+			return nil, http.StatusNotFound, errors.New(errStr)
+		}
+		if id == "empty" {
+			return nil, http.StatusNoContent, nil
+		}
+		return &handleOutput{Id: id}, http.StatusOK, nil
+	}))
+
+	testCases := []struct {
+		id             string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"abc", http.StatusOK, `{"id":"abc","name":""}`},
+		{"empty", http.StatusNoContent, ""},
+	}
+	for _, tc := range testCases {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", "/things/"+tc.id, nil))
+		equals(t, tc.expectedStatus, recorder.Code)
+		equals(t, tc.expectedBody, recorder.Body.String())
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/things/missing", nil))
+	equals(t, http.StatusNotFound, recorder.Code)
+	equals(t, errStr, readProblem(t, recorder)["detail"])
+}
+
+func TestHandleList(t *testing.T) {
+	testCases := []struct {
+		output   []*handleOutput
+		expected string
+	}{
+		{[]*handleOutput{{Id: "a", Name: "b"}, {Id: "c", Name: "d"}}, `[{"id":"a","name":"b"},{"id":"c","name":"d"}]`},
+		{nil, `[]`},
+	}
+
+	for _, tc := range testCases {
+		output := tc.output
+		handler := server.HandleList(func(ctx context.Context, _ *server.NoInput) ([]*handleOutput, int, error) {
+			return output, http.StatusOK, nil
+		})
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest("GET", "/", nil))
+
+		equals(t, http.StatusOK, recorder.Code)
+		equals(t, tc.expected, recorder.Body.String())
+	}
+}
@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Gamma169/go-server-helpers/server"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+/*********************************************
+ * Helpers
+ * *******************************************/
+
+func passingCheck(context.Context) error { return nil }
+func failingCheck(context.Context) error { return errors.New("check failed") }
+
+func getHealthReport(t *testing.T, router *mux.Router, path string) (int, server.HealthReport) {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+	var report server.HealthReport
+	ok(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	equals(t, server.JSONContentType, recorder.Result().Header.Get(server.ContentTypeHeader))
+	return recorder.Code, report
+}
+
+/*********************************************
+ * Tests
+ * *******************************************/
+
+func TestHealthEndpoints(t *testing.T) {
+	testCases := []struct {
+		checks           []server.HealthCheck
+		ready            bool
+		expectedLive     int
+		expectedReady    int
+		expectedStatus   string
+		expectedNumLive  int
+		expectedNumReady int
+	}{
+		{[]server.HealthCheck{}, true, 200, 200, server.HealthStatusOK, 0, 0},
+		{[]server.HealthCheck{
+			{Name: "db", Check: passingCheck, Critical: true},
+			{Name: "cache", Check: passingCheck},
+		}, true, 200, 200, server.HealthStatusOK, 0, 2},
+		{[]server.HealthCheck{
+			{Name: "db", Check: passingCheck, Critical: true},
+			{Name: "cache", Check: failingCheck},
+		}, true, 200, 200, server.HealthStatusDegraded, 0, 2},
+		// Critical failure only fails liveness if the check is marked for liveness
+		{[]server.HealthCheck{
+			{Name: "db", Check: failingCheck, Critical: true},
+			{Name: "self", Check: passingCheck, Critical: true, Liveness: true},
+		}, true, 200, 503, server.HealthStatusFail, 1, 2},
+		{[]server.HealthCheck{
+			{Name: "self", Check: failingCheck, Critical: true, Liveness: true},
+		}, true, 503, 503, server.HealthStatusFail, 1, 1},
+		// Not ready (ex: shutting down) fails readiness even if checks pass
+		{[]server.HealthCheck{
+			{Name: "db", Check: passingCheck, Critical: true},
+		}, false, 200, 503, server.HealthStatusFail, 0, 1},
+	}
+
+	for _, tc := range testCases {
+		readiness := server.NewReadiness()
+		readiness.SetReady(tc.ready)
+		registry := server.NewHealthRegistry(readiness)
+		for _, check := range tc.checks {
+			registry.Register(check)
+		}
+		router := mux.NewRouter()
+		// FUNCTION TO TEST:
+		server.AddHealthEndpoints(router, registry)
+
+		code, report := getHealthReport(t, router, "/healthz")
+		equals(t, tc.expectedLive, code)
+		equals(t, tc.expectedNumLive, len(report.Checks))
+
+		code, report = getHealthReport(t, router, "/readyz")
+		equals(t, tc.expectedReady, code)
+		equals(t, tc.expectedStatus, report.Status)
+		equals(t, tc.expectedNumReady, len(report.Checks))
+		equals(t, tc.ready, *report.Ready)
+		for i, result := range report.Checks {
+			equals(t, tc.checks[i].Name, result.Name)
+		}
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	registry := server.NewHealthRegistry(nil)
+	registry.Register(server.HealthCheck{
+		Name:     "slow",
+		Timeout:  10 * time.Millisecond,
+		Critical: true,
+		Check: func(ctx context.Context) error {
+			// Ignores the context on purpose
+			time.Sleep(time.Second)
+			return nil
+		},
+	})
+
+	start := time.Now()
+	report := registry.Run(context.Background(), false)
+	assert(t, time.Since(start) < 500*time.Millisecond, "Should not wait for checks past their timeout")
+	equals(t, server.HealthStatusFail, report.Status)
+	equals(t, server.HealthStatusFail, report.Checks[0].Status)
+	equals(t, "timeout", report.Checks[0].Error)
+}
+
+func TestHealthCheckErrorsAreMasked(t *testing.T) {
+	registry := server.NewHealthRegistry(nil)
+	registry.Register(server.HealthCheck{
+		Name: "db",
+		Check: func(context.Context) error {
+			return errors.New("dial tcp 10.0.0.5:5432: connect: connection refused")
+		},
+	})
+
+	// FUNCTION TO TEST:
+	report := registry.Run(context.Background(), false)
+	equals(t, "check failed", report.Checks[0].Error)
+
+	server.DebugErrors = true
+	defer func() { server.DebugErrors = false }()
+	report = registry.Run(context.Background(), false)
+	equals(t, "dial tcp 10.0.0.5:5432: connect: connection refused", report.Checks[0].Error)
+}
+
+func TestReadinessFailsDuringShutdown(t *testing.T) {
+	readiness := server.NewReadiness()
+	registry := server.NewHealthRegistry(readiness)
+	router := mux.NewRouter()
+	server.AddHealthEndpoints(router, registry)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- server.Run(ctx, server.RunConfig{Readiness: readiness})
+	}()
+
+	waitUntil(t, readiness.IsReady, "Should mark ready once servers start")
+	code, _ := getHealthReport(t, router, "/readyz")
+	equals(t, http.StatusOK, code)
+
+	cancel()
+	ok(t, <-done)
+	code, _ = getHealthReport(t, router, "/readyz")
+	equals(t, http.StatusServiceUnavailable, code)
+}
@@ -1,11 +1,17 @@
 package tests
 
 import (
+	"context"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -57,3 +63,113 @@ func randString(n int) string {
 	}
 	return string(b)
 }
+
+// Generates a random status that is allowed to have a body (ex: not 1xx, 204 or 304)
+func randStatusWithBody() int {
+	for {
+		status := rand.Intn(400) + 200
+		if status != 204 && status != 304 {
+			return status
+		}
+	}
+}
+
+func randErrorStatus() int {
+	return rand.Intn(200) + 400
+}
+
+/*********************************************
+ * Fake database/sql Driver
+ *
+ * A driver that doesn't need a database-- it records the statements run on it,
+ * returns the same columns and rows for every query, and fails queries starting with FAIL
+ * and the first commits with commitErrs
+ * *******************************************/
+
+var errFakeQuery = errors.New("fake query failed")
+
+type fakeDatabase struct {
+	columns    []string
+	rows       [][]driver.Value
+	commitErrs []error
+
+	mu         sync.Mutex
+	statements []string
+	txOptions  []driver.TxOptions
+}
+
+type fakeConnector struct{ fake *fakeDatabase }
+type fakeConn struct{ fake *fakeDatabase }
+type fakeTx struct{ fake *fakeDatabase }
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (fakeConnector) Driver() driver.Driver                          { return nil }
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+func (c fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.fake.record("BEGIN")
+	c.fake.mu.Lock()
+	c.fake.txOptions = append(c.fake.txOptions, opts)
+	c.fake.mu.Unlock()
+	return fakeTx(c), nil
+}
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.fake.record(query)
+	if strings.HasPrefix(query, "FAIL") {
+		return nil, errFakeQuery
+	}
+	return &fakeRows{c.fake.columns, c.fake.rows}, nil
+}
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.fake.record(query)
+	if strings.HasPrefix(query, "FAIL") {
+		return nil, errFakeQuery
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (tx fakeTx) Commit() error {
+	tx.fake.record("COMMIT")
+	tx.fake.mu.Lock()
+	defer tx.fake.mu.Unlock()
+	if len(tx.fake.commitErrs) > 0 {
+		err := tx.fake.commitErrs[0]
+		tx.fake.commitErrs = tx.fake.commitErrs[1:]
+		return err
+	}
+	return nil
+}
+func (tx fakeTx) Rollback() error {
+	tx.fake.record("ROLLBACK")
+	return nil
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func (f *fakeDatabase) record(statement string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statements = append(f.statements, statement)
+}
+
+// The statements run so far, separated by "; "
+func (f *fakeDatabase) log() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return strings.Join(f.statements, "; ")
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Gamma169/go-server-helpers/logging"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*********************************************
+ * Tests
+ * *******************************************/
+
+func TestLoggerLevels(t *testing.T) {
+	testCases := []struct {
+		level    logging.Level
+		expected []string
+	}{
+		{logging.LevelDebug, []string{"debug", "info", "warn", "error"}},
+		{logging.LevelInfo, []string{"info", "warn", "error"}},
+		{logging.LevelWarn, []string{"warn", "error"}},
+		{logging.LevelError, []string{"error"}},
+	}
+
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		logger := logging.New(logging.NewJSONSink(&buf), tc.level)
+		logger.Debug(randString(20))
+		logger.Info(randString(20))
+		logger.Warn(randString(20))
+		logger.Error(randString(20))
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		equals(t, len(tc.expected), len(lines))
+		for i, line := range lines {
+			var entry map[string]interface{}
+			ok(t, json.Unmarshal([]byte(line), &entry))
+			equals(t, tc.expected[i], entry["level"])
+		}
+	}
+}
+
+func TestJSONSinkFields(t *testing.T) {
+	var buf bytes.Buffer
+	msg := randString(40)
+	errStr := randString(40)
+	logger := logging.New(logging.NewJSONSink(&buf), logging.LevelDebug).With(logging.Fields{"base": "val", "override": 1})
+	logger.Info(msg, logging.Fields{
+		"override":               2,
+		logging.FieldError:       errors.New(errStr),
+		logging.FieldDuration:    1500 * time.Millisecond,
+		logging.FieldRequesterId: "some-id",
+	})
+
+	var entry map[string]interface{}
+	ok(t, json.Unmarshal(buf.Bytes(), &entry))
+	equals(t, msg, entry["msg"])
+	equals(t, "val", entry["base"])
+	equals(t, float64(2), entry["override"])
+	equals(t, errStr, entry[logging.FieldError])
+	equals(t, 1.5, entry[logging.FieldDuration])
+	equals(t, "some-id", entry[logging.FieldRequesterId])
+	_, err := time.Parse(time.RFC3339Nano, entry["time"].(string))
+	ok(t, err)
+}
+
+func TestConsoleSink(t *testing.T) {
+	var buf bytes.Buffer
+	msg := randString(40)
+	logging.New(logging.NewConsoleSink(&buf), logging.LevelDebug).Warn(msg, logging.Fields{"b": 2, "a": 1})
+
+	out := buf.String()
+	assert(t, strings.Contains(out, "WARN"), "Should contain level")
+	assert(t, strings.Contains(out, msg), "Should contain message")
+	assert(t, strings.Contains(out, "  a=1  b=2\n"), "Should contain sorted fields, got: %s", out)
+}
+
+func TestContextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(logging.NewJSONSink(&buf), logging.LevelDebug)
+
+	ctx := logging.NewContext(context.Background(), logger, logging.Fields{logging.FieldTraceId: "trace"})
+	logging.AddFields(ctx, logging.Fields{logging.FieldRequesterId: "requester"})
+	logging.FromContext(ctx).Info(randString(20))
+
+	var entry map[string]interface{}
+	ok(t, json.Unmarshal(buf.Bytes(), &entry))
+	equals(t, "trace", entry[logging.FieldTraceId])
+	equals(t, "requester", entry[logging.FieldRequesterId])
+
+	// Context without a logger should fall back to the default and AddFields should be a no-op
+	logging.AddFields(context.Background(), logging.Fields{"foo": "bar"})
+	equals(t, logging.Default(), logging.FromContext(context.Background()))
+}
+
+func TestParseLevel(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected logging.Level
+		found    bool
+	}{
+		{"debug", logging.LevelDebug, true},
+		{"INFO", logging.LevelInfo, true},
+		{" warning ", logging.LevelWarn, true},
+		{"Error", logging.LevelError, true},
+		{"not-a-level", logging.LevelInfo, false},
+	}
+
+	for _, tc := range testCases {
+		level, found := logging.ParseLevel(tc.name)
+		equals(t, tc.expected, level)
+		equals(t, tc.found, found)
+	}
+}
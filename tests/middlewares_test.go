@@ -2,16 +2,18 @@ package tests
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"github.com/Gamma169/go-server-helpers/logging"
 	"github.com/Gamma169/go-server-helpers/server"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"log"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 )
 
 /*********************************************
@@ -38,6 +40,9 @@ func TestAddCORSMiddlewareAndEndpoint(t *testing.T) {
 
 		req, err := http.NewRequest("OPTIONS", path, nil)
 		ok(t, err)
+		origin := "https://" + randString(20) + ".com"
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPut)
 
 		rr := httptest.NewRecorder()
 
@@ -53,7 +58,9 @@ func TestAddCORSMiddlewareAndEndpoint(t *testing.T) {
 			expected string
 		}{
 			{"Access-Control-Allow-Origin", "*"},
-			{"Access-Control-Allow-Credentials", "true"},
+			{"Vary", "Origin"},
+			// Credentials are never allowed from any origin
+			{"Access-Control-Allow-Credentials", ""},
 			{"Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, Session, " + requesterId},
 			{"Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE"},
 		}
@@ -64,6 +71,130 @@ func TestAddCORSMiddlewareAndEndpoint(t *testing.T) {
 	}
 }
 
+func TestAddCORSMiddlewareAndEndpointWithConfig(t *testing.T) {
+	config := server.CORSConfig{
+		AllowedOrigins:        []string{"https://app.example.com", "https://*.example.org"},
+		AllowedOriginPatterns: []*regexp.Regexp{regexp.MustCompile(`https://pr-\d+\.example\.net`)},
+		AllowOriginFunc: func(origin string, r *http.Request) bool {
+			return origin == "https://callback.example.io"
+		},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPut},
+		AllowedHeaders:   []string{"Content-Type", "X-Custom"},
+		ExposedHeaders:   []string{"X-Trace"},
+		MaxAge:           10 * time.Minute,
+		AllowCredentials: true,
+	}
+
+	testCases := []struct {
+		method          string
+		origin          string
+		requestMethod   string
+		requestHeaders  string
+		expectedStatus  int
+		expectedOrigin  string
+		handlerIsCalled bool
+	}{
+		// Preflights
+		{http.MethodOptions, "https://app.example.com", http.MethodPut, "content-type", http.StatusNoContent, "https://app.example.com", false},
+		{http.MethodOptions, "https://sub.example.org", http.MethodPut, "X-Custom, Content-Type", http.StatusNoContent, "https://sub.example.org", false},
+		{http.MethodOptions, "https://pr-42.example.net", http.MethodGet, "", http.StatusNoContent, "https://pr-42.example.net", false},
+		// Patterns must match the whole origin even if they are not anchored
+		{http.MethodOptions, "https://pr-42.example.net.evil.com", http.MethodGet, "", http.StatusForbidden, "", false},
+		{http.MethodOptions, "https://evil.com/https://pr-42.example.net", http.MethodGet, "", http.StatusForbidden, "", false},
+		{http.MethodOptions, "https://callback.example.io", http.MethodGet, "", http.StatusNoContent, "https://callback.example.io", false},
+		{http.MethodOptions, "https://example.org", http.MethodPut, "", http.StatusForbidden, "", false},
+		{http.MethodOptions, "https://evil.com", http.MethodPut, "", http.StatusForbidden, "", false},
+		{http.MethodOptions, "https://app.example.com", http.MethodDelete, "", http.StatusForbidden, "https://app.example.com", false},
+		{http.MethodOptions, "https://app.example.com", http.MethodPut, "X-Not-Allowed", http.StatusForbidden, "https://app.example.com", false},
+		// Actual requests
+		{http.MethodGet, "https://app.example.com", "", "", http.StatusOK, "https://app.example.com", true},
+		{http.MethodGet, "https://evil.com", "", "", http.StatusOK, "", true},
+		{http.MethodGet, "", "", "", http.StatusOK, "", true},
+	}
+
+	for _, tc := range testCases {
+		path := "/" + randString(25)
+		req, err := http.NewRequest(tc.method, path, nil)
+		ok(t, err)
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		if tc.requestMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", tc.requestMethod)
+		}
+		if tc.requestHeaders != "" {
+			req.Header.Set("Access-Control-Request-Headers", tc.requestHeaders)
+		}
+
+		handlerCalled := false
+		router := mux.NewRouter()
+		router.Path(path).Methods(http.MethodGet).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlerCalled = true
+		})
+		// FUNCTION TO TEST:
+		server.AddCORSMiddlewareAndEndpointWithConfig(router, config)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		headers := rr.Result().Header
+		equals(t, tc.expectedStatus, rr.Code)
+		equals(t, tc.handlerIsCalled, handlerCalled)
+		equals(t, tc.expectedOrigin, headers.Get("Access-Control-Allow-Origin"))
+		equals(t, "Origin", headers.Values("Vary")[0])
+
+		if tc.expectedStatus == http.StatusNoContent {
+			equals(t, "true", headers.Get("Access-Control-Allow-Credentials"))
+			equals(t, "GET, PUT", headers.Get("Access-Control-Allow-Methods"))
+			equals(t, "Content-Type, X-Custom", headers.Get("Access-Control-Allow-Headers"))
+			equals(t, "600", headers.Get("Access-Control-Max-Age"))
+		}
+		if tc.method == http.MethodGet && tc.expectedOrigin != "" {
+			equals(t, "X-Trace", headers.Get("Access-Control-Expose-Headers"))
+		}
+	}
+}
+
+func TestCORSWildcardWithoutCredentials(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	ok(t, err)
+	req.Header.Set("Origin", "https://"+randString(20)+".com")
+
+	router := mux.NewRouter()
+	router.Path("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	server.AddCORSMiddlewareAndEndpointWithConfig(router, server.CORSConfig{AllowedOrigins: []string{"*"}})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	equals(t, "*", rr.Result().Header.Get("Access-Control-Allow-Origin"))
+	equals(t, "", rr.Result().Header.Get("Access-Control-Allow-Credentials"))
+}
+
+func TestDefaultCORSConfigDoesNotAllowCredentials(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://"+randString(20)+".com")
+
+	router := mux.NewRouter()
+	router.Path("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	server.AddCORSMiddlewareAndEndpoint(router, "some-id")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	equals(t, "*", rr.Result().Header.Get("Access-Control-Allow-Origin"))
+	equals(t, "", rr.Result().Header.Get("Access-Control-Allow-Credentials"))
+
+	// Any origin with credentials is a config error instead of reflecting every origin
+	config := server.DefaultCORSConfig("some-id")
+	config.AllowCredentials = true
+	assert(t, config.Validate() != nil, "Should not allow credentials from any origin")
+	defer func() {
+		assert(t, recover() != nil, "Should panic with an invalid config")
+	}()
+	server.AddCORSMiddlewareAndEndpointWithConfig(mux.NewRouter(), config)
+}
+
 func TestRequesterIdHeaderMiddleware(t *testing.T) {
 	requesterId := randString(25)
 
@@ -89,7 +220,12 @@ func TestRequesterIdHeaderMiddleware(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		router := mux.NewRouter()
-		router.Path(randEndpoint).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		var receivedRequesterId uuid.UUID
+		router.Path(randEndpoint).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var found bool
+			receivedRequesterId, found = server.RequesterIDFromContext(r.Context())
+			assert(t, found, "Should store requester id in context")
+		})
 		// FUNCTION TO TEST:
 		server.AddRequesterIdHeaderMiddleware(router, requesterId, false)
 
@@ -97,6 +233,7 @@ func TestRequesterIdHeaderMiddleware(t *testing.T) {
 
 		if testCase.shouldPass {
 			equals(t, http.StatusOK, rr.Code)
+			equals(t, testCase.value, receivedRequesterId.String())
 		} else {
 			equals(t, http.StatusBadRequest, rr.Code)
 		}
@@ -109,19 +246,20 @@ func TestAddLoggingMiddleware(t *testing.T) {
 	testCases := []struct {
 		header    string
 		value     string
+		status    int
 		shouldLog bool
 	}{
-		{traceIdHeader, uuid.New().String(), true},
-		{traceIdHeader, uuid.New().String(), true},
-		{"not-trace-id", "qwe", false},
-		{"not-req-id", "bad-val", false},
+		{traceIdHeader, uuid.New().String(), http.StatusOK, true},
+		{traceIdHeader, uuid.New().String(), http.StatusInternalServerError, true},
+		// Trace ids that are not UUIDs are kept as is, but not stored in the context
+		{traceIdHeader, randString(25), http.StatusAccepted, true},
+		{"not-trace-id", "qwe", http.StatusNotFound, false},
+		{"not-req-id", "bad-val", http.StatusBadGateway, false},
 	}
 
 	var buf bytes.Buffer
-	log.SetOutput(&buf)
-	defer func() {
-		log.SetOutput(os.Stderr)
-	}()
+	defer logging.SetDefault(logging.Default())
+	logging.SetDefault(logging.New(logging.NewJSONSink(&buf), logging.LevelDebug))
 
 	for _, testCase := range testCases {
 
@@ -134,21 +272,99 @@ func TestAddLoggingMiddleware(t *testing.T) {
 
 		router := mux.NewRouter()
 		var receivedHeaders http.Header
+		var receivedTraceId uuid.UUID
+		var foundTraceId bool
 		router.Path(randEndpoint).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			receivedHeaders = r.Header
+			receivedTraceId, foundTraceId = server.TraceIDFromContext(r.Context())
+			w.WriteHeader(testCase.status)
 		})
 		// FUNCTION TO TEST:
 		server.AddLoggingMiddleware(router, traceIdHeader, true)
 
 		router.ServeHTTP(rr, req)
 
+		equals(t, testCase.status, rr.Code)
 		equals(t, testCase.value, receivedHeaders.Get(testCase.header))
-		assert(t, rr.Result().Header.Get(testCase.header) == "", "Should not respond with header")
+		equals(t, receivedHeaders.Get(traceIdHeader), rr.Result().Header.Get(traceIdHeader))
+		if _, err := uuid.Parse(receivedHeaders.Get(traceIdHeader)); err == nil {
+			assert(t, foundTraceId, "Should store trace id in context")
+			equals(t, receivedTraceId.String(), receivedHeaders.Get(traceIdHeader))
+		} else {
+			assert(t, !foundTraceId, "Should not store a trace id that is not a UUID in context")
+		}
 
 		if testCase.shouldLog {
 			doesLogTrace := strings.Contains(buf.String(), testCase.value)
 			assert(t, doesLogTrace, "Should log trace in output")
 		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		equals(t, 2, len(lines))
+		var finished map[string]interface{}
+		ok(t, json.Unmarshal([]byte(lines[1]), &finished))
+		equals(t, "Finished request", finished["msg"])
+		equals(t, float64(testCase.status), finished[logging.FieldStatus])
+		equals(t, randEndpoint, finished[logging.FieldRoute])
+		equals(t, receivedHeaders.Get(traceIdHeader), finished[logging.FieldTraceId])
+		_, hasDuration := finished[logging.FieldDuration]
+		assert(t, hasDuration, "Should log duration of request")
+		if testCase.status >= 500 {
+			equals(t, "error", finished["level"])
+		} else if testCase.status >= 400 {
+			equals(t, "warn", finished["level"])
+		} else {
+			equals(t, "info", finished["level"])
+		}
 		buf = bytes.Buffer{}
 	}
 }
+
+func TestAddLoggingMiddlewareLogsRequesterId(t *testing.T) {
+	traceIdHeader := randString(25)
+	requesterIdHeader := randString(25)
+	requesterId := uuid.New().String()
+
+	var buf bytes.Buffer
+	defer logging.SetDefault(logging.Default())
+	logging.SetDefault(logging.New(logging.NewJSONSink(&buf), logging.LevelInfo))
+
+	req, err := http.NewRequest("GET", "/users/"+randString(25), nil)
+	ok(t, err)
+	req.Header.Add(requesterIdHeader, requesterId)
+
+	router := mux.NewRouter()
+	router.Path("/users/{id}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("In handler")
+	})
+	// Order matters-- logging middleware must come first so requester id is added to its fields
+	server.AddLoggingMiddleware(router, traceIdHeader, false)
+	server.AddRequesterIdHeaderMiddleware(router, requesterIdHeader, false)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	// Debug is false so there should be no "Received" line
+	equals(t, 2, len(lines))
+	for _, line := range lines {
+		var entry map[string]interface{}
+		ok(t, json.Unmarshal([]byte(line), &entry))
+		equals(t, requesterId, entry[logging.FieldRequesterId])
+		equals(t, "/users/{id}", entry[logging.FieldRoute])
+	}
+}
+
+func TestAddLoggingMiddlewareWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(logging.NewJSONSink(&buf), logging.LevelInfo)
+
+	router := mux.NewRouter()
+	router.Path("/users/{id}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("In handler")
+	})
+	// FUNCTION TO TEST:
+	server.AddLoggingMiddlewareWithLogger(router, logger, randString(25), false)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/1", nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	equals(t, 2, len(lines))
+	assert(t, strings.Contains(lines[0], "In handler") && strings.Contains(lines[1], "Finished request"), "Should log with the logger passed in: %s", buf.String())
+}
@@ -1,6 +1,9 @@
 package tests
 
 import (
+	"context"
+	"database/sql"
+	"github.com/Gamma169/go-server-helpers/db"
 	"testing"
 )
 
@@ -11,3 +14,15 @@ import (
 func TestInitPostgresMigrations(t *testing.T) {
 	t.Skip("TODO")
 }
+
+func TestRunPostgresMigrationsStopsWaitingOnCancel(t *testing.T) {
+	dbConn, err := sql.Open("postgres", "host=127.0.0.1 port=1 user=u dbname=d sslmode=disable")
+	ok(t, err)
+	defer dbConn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// FUNCTION TO TEST:
+	err = db.RunPostgresMigrations(ctx, dbConn, 60000, false, false)
+	equals(t, context.Canceled, err)
+}
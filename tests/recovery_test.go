@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/Gamma169/go-server-helpers/logging"
+	"github.com/Gamma169/go-server-helpers/server"
+	"github.com/google/jsonapi"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAddRecoveryMiddleware(t *testing.T) {
+	traceIdHeader := randString(25)
+
+	testCases := []struct {
+		panicValue     interface{}
+		debugErrors    bool
+		writeFirst     bool
+		expectedStatus int
+		expectedErr    string
+	}{
+		{"boom", false, false, http.StatusInternalServerError, "panic: boom"},
+		{errors.New("some db error"), false, false, http.StatusInternalServerError, "some db error"},
+		{errors.New("some db error"), true, false, http.StatusInternalServerError, "some db error"},
+		// Too late to change the status, so the response is aborted
+		{42, false, true, http.StatusAccepted, "panic: 42"},
+	}
+
+	var buf bytes.Buffer
+	defer logging.SetDefault(logging.Default())
+	logging.SetDefault(logging.New(logging.NewJSONSink(&buf), logging.LevelInfo))
+	defer func() { server.DebugErrors = false }()
+
+	for _, tc := range testCases {
+		buf.Reset()
+		server.DebugErrors = tc.debugErrors
+
+		var reportedErr error
+		var reportedStack []byte
+		router := mux.NewRouter()
+		router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if tc.writeFirst {
+				w.WriteHeader(http.StatusAccepted)
+			}
+			panic(tc.panicValue)
+		})
+		server.AddLoggingMiddleware(router, traceIdHeader, false)
+		// FUNCTION TO TEST:
+		server.AddRecoveryMiddleware(router, func(r *http.Request, err error, stack []byte) {
+			reportedErr = err
+			reportedStack = stack
+		})
+
+		recorder := httptest.NewRecorder()
+		var recovered interface{}
+		func() {
+			defer func() { recovered = recover() }()
+			router.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+		}()
+
+		equals(t, tc.expectedStatus, recorder.Code)
+		equals(t, tc.expectedErr, reportedErr.Error())
+		assert(t, strings.Contains(string(reportedStack), "recovery_test.go"), "Should report the stack of the panic")
+
+		if tc.writeFirst {
+			equals(t, http.ErrAbortHandler, recovered)
+		} else {
+			equals(t, nil, recovered)
+			equals(t, server.ProblemJSONContentType, recorder.Result().Header.Get(server.ContentTypeHeader))
+			problem := readProblem(t, recorder)
+			equals(t, "internal_error", problem["code"])
+			equals(t, recorder.Result().Header.Get(traceIdHeader), problem["traceId"])
+			if tc.debugErrors {
+				equals(t, tc.expectedErr, problem["detail"])
+			} else {
+				_, hasDetail := problem["detail"]
+				assert(t, !hasDetail, "Should not send the panic to the client")
+			}
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		var panicLog map[string]interface{}
+		ok(t, json.Unmarshal([]byte(lines[0]), &panicLog))
+		equals(t, "Recovered from panic", panicLog["msg"])
+		equals(t, tc.expectedErr, panicLog[logging.FieldError])
+		equals(t, recorder.Result().Header.Get(traceIdHeader), panicLog[logging.FieldTraceId])
+		assert(t, strings.Contains(panicLog["stack"].(string), "recovery_test.go"), "Should log the stack of the panic")
+		// The abort panic goes through the logging middleware, so there is no "Finished" line
+		if tc.writeFirst {
+			equals(t, 1, len(lines))
+		} else {
+			equals(t, 2, len(lines))
+			var finishedLog map[string]interface{}
+			ok(t, json.Unmarshal([]byte(lines[1]), &finishedLog))
+			equals(t, float64(tc.expectedStatus), finishedLog[logging.FieldStatus])
+		}
+	}
+}
+
+func TestAddRecoveryMiddlewareJSONAPI(t *testing.T) {
+	defer logging.SetDefault(logging.Default())
+	logging.SetDefault(logging.New(logging.NewJSONSink(&bytes.Buffer{}), logging.LevelInfo))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]string
+		m["nil"] = "map"
+	})
+	// FUNCTION TO TEST:
+	server.AddRecoveryMiddleware(router, nil)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(server.AcceptContentTypeHeader, jsonapi.MediaType)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	equals(t, http.StatusInternalServerError, recorder.Code)
+	equals(t, jsonapi.MediaType, recorder.Result().Header.Get(server.ContentTypeHeader))
+	var payload jsonapi.ErrorsPayload
+	ok(t, json.NewDecoder(recorder.Body).Decode(&payload))
+	equals(t, 1, len(payload.Errors))
+	equals(t, "internal_error", payload.Errors[0].Code)
+}
+
+func TestAddRecoveryMiddlewareAbortHandler(t *testing.T) {
+	reported := false
+	router := mux.NewRouter()
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	// FUNCTION TO TEST:
+	server.AddRecoveryMiddleware(router, func(*http.Request, error, []byte) { reported = true })
+
+	defer func() {
+		equals(t, http.ErrAbortHandler, recover())
+		assert(t, !reported, "Should not report aborted handlers")
+	}()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	t.Fatal("Should re-panic http.ErrAbortHandler")
+}
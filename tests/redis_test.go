@@ -1,13 +1,87 @@
 package tests
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Gamma169/go-server-helpers/db"
+	envs "github.com/Gamma169/go-server-helpers/environments"
+	"github.com/go-redis/redis/v8"
+	"strings"
 	"testing"
+	"time"
 )
 
 /*********************************************
  * Tests
  * *******************************************/
 
+func TestLoadRedisConfig(t *testing.T) {
+	prefix := randString(20) + "_"
+
+	// FUNCTION TO TEST:
+	_, err := db.LoadRedisConfig(prefix, false)
+	assert(t, err != nil && strings.Contains(err.Error(), prefix+"REDIS_HOST"), "Should require the host: %v", err)
+
+	defer setEnvs(map[string]string{
+		prefix + "REDIS_TLS_HOST":     "cache",
+		prefix + "REDIS_TLS_PORT":     "6380",
+		prefix + "REDIS_TLS_PASSWORD": "pass",
+	})()
+	cfg, err := db.LoadRedisConfig(prefix, true)
+	ok(t, err)
+	options, err := cfg.Options()
+	ok(t, err)
+	equals(t, "cache:6380", options.Addr)
+	equals(t, "pass", options.Password)
+
+	urlPrefix := randString(20) + "_"
+	defer setEnvs(map[string]string{urlPrefix + "REDIS_URL": "redis://:pass@cache:6390/2"})()
+	cfg, err = db.LoadRedisConfig(urlPrefix, false)
+	ok(t, err)
+	options, err = cfg.Options()
+	ok(t, err)
+	equals(t, "cache:6390", options.Addr)
+	equals(t, 2, options.DB)
+}
+
+func TestLoadRedisConfigFromEnv(t *testing.T) {
+	env := envs.NewEnv(envs.MapSource{"APP_REDIS_TLS_HOST": "cache"})
+
+	// FUNCTION TO TEST:
+	cfg, err := db.LoadRedisConfigFromEnv(env, "APP_", true)
+	ok(t, err)
+	options, err := cfg.Options()
+	ok(t, err)
+	equals(t, "cache:6379", options.Addr)
+
+	_, err = db.LoadRedisConfigFromEnv(env, "APP_", false)
+	assert(t, err != nil && strings.Contains(err.Error(), "APP_REDIS_HOST"), "Should require the non-TLS host: %v", err)
+}
+
+func TestInitRedisFromEnvRejectsInvalidTLSFlag(t *testing.T) {
+	env := envs.NewEnv(envs.MapSource{"APP_REDIS_HOST": "cache", "USE_TLS_CONFIG": "maybe"})
+	defer func() {
+		r := recover()
+		assert(t, r != nil && strings.Contains(fmt.Sprint(r), "USE_TLS_CONFIG"), "Should panic with the invalid var: %v", r)
+	}()
+	db.InitRedisFromEnv(env, "APP_", false, false)
+}
+
+func TestOpenRedis(t *testing.T) {
+	// FUNCTION TO TEST:
+	_, err := db.OpenRedis(context.Background(), db.RedisConfig{})
+	assert(t, errors.Is(err, db.ErrMissingConfig) && strings.Contains(err.Error(), "HOST"), "Should return ErrMissingConfig: %v", err)
+	// The config could have been loaded with any prefix, so it can't name the env var
+	assert(t, !strings.Contains(err.Error(), "REDIS_HOST"), "Should not guess the prefix: %v", err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = db.OpenRedis(ctx, db.RedisConfig{Host: "127.0.0.1", Port: 1})
+	assert(t, errors.Is(err, db.ErrUnreachable), "Should return ErrUnreachable: %v", err)
+	assert(t, !errors.Is(err, db.ErrAuth), "Should not be an auth error: %v", err)
+}
+
 func TestInitRedis(t *testing.T) {
 	t.Skip("TODO")
 }
@@ -19,3 +93,12 @@ func TestCheckRedisConnection(t *testing.T) {
 func TestValidateRedisConnOrPanic(t *testing.T) {
 	t.Skip("TODO")
 }
+
+func TestRedisHealthCheck(t *testing.T) {
+	// Nothing listens on port 1, so the check should fail quickly
+	redisClient := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer redisClient.Close()
+
+	err := db.RedisHealthCheck(redisClient)(context.Background())
+	assert(t, err != nil, "Should return error if redis is unreachable")
+}
@@ -2,6 +2,7 @@ package tests
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/Gamma169/go-server-helpers/server"
@@ -44,6 +45,12 @@ const jsonFmt = `{
 }
 `
 
+func readProblem(t *testing.T, recorder *httptest.ResponseRecorder) map[string]interface{} {
+	var problem map[string]interface{}
+	ok(t, json.NewDecoder(recorder.Result().Body).Decode(&problem))
+	return problem
+}
+
 /*********************************************
  * Test Preprocess
  * *******************************************/
@@ -286,17 +293,17 @@ func TestStandardRequestHandler(t *testing.T) {
 	assert(t, err != nil, "Should return the error")
 	equals(t, errStr, err.Error())
 	assert(t, logFnCalled, "Should call error logfn when errored")
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(recorder.Result().Body)
-	bodyStr := buf.String()
-	equals(t, errStr+"\n", bodyStr)
+	equals(t, server.ProblemJSONContentType, recorder.Result().Header.Get(server.ContentTypeHeader))
+	problem := readProblem(t, recorder)
+	equals(t, float64(400), problem["status"])
+	equals(t, errStr, problem["detail"])
 
 	// Checking returned status on logic error
 
 	logFnCalled = false
 	statusRecieved = 0
 	err = nil
-	statusToReturn = rand.Intn(401) + 100
+	statusToReturn = randErrorStatus()
 	// Important to use new recorder
 	recorder = httptest.NewRecorder()
 
@@ -322,10 +329,14 @@ func TestStandardRequestHandler(t *testing.T) {
 
 	equals(t, statusToReturn, recorder.Code)
 	assert(t, logFnCalled, "Should call error logfn when errored")
-	buf = new(bytes.Buffer)
-	buf.ReadFrom(recorder.Result().Body)
-	bodyStr = buf.String()
-	equals(t, errStr+"\n", bodyStr)
+	problem = readProblem(t, recorder)
+	equals(t, float64(statusToReturn), problem["status"])
+	if statusToReturn >= 500 {
+		_, hasDetail := problem["detail"]
+		assert(t, !hasDetail, "Should mask details of internal errors")
+	} else {
+		equals(t, errStr, problem["detail"])
+	}
 }
 
 // This test checks the AgnosticHandler, but effectively tests everything else under the hood
@@ -344,10 +355,10 @@ func TestStandardAgnosticRequestHandler(t *testing.T) {
 		{uuid.New().String(), randString(60), server.JSONContentType, 201, jsonFmt},
 		{uuid.New().String(), randString(60), jsonapi.MediaType, 200, jsonapiFmt},
 		{uuid.New().String(), randString(60), jsonapi.MediaType, 201, jsonapiFmt},
-		{uuid.New().String(), randString(60), server.JSONContentType, rand.Intn(401) + 100, jsonFmt},
-		{uuid.New().String(), randString(60), server.JSONContentType, rand.Intn(401) + 100, jsonFmt},
-		{uuid.New().String(), randString(60), jsonapi.MediaType, rand.Intn(401) + 100, jsonapiFmt},
-		{uuid.New().String(), randString(60), jsonapi.MediaType, rand.Intn(401) + 100, jsonapiFmt},
+		{uuid.New().String(), randString(60), server.JSONContentType, randStatusWithBody(), jsonFmt},
+		{uuid.New().String(), randString(60), server.JSONContentType, randStatusWithBody(), jsonFmt},
+		{uuid.New().String(), randString(60), jsonapi.MediaType, randStatusWithBody(), jsonapiFmt},
+		{uuid.New().String(), randString(60), jsonapi.MediaType, randStatusWithBody(), jsonapiFmt},
 	}
 
 	for _, tc := range testCases {
@@ -504,10 +515,10 @@ func TestCheckJSONMarshalAndWrite(t *testing.T) {
 	}{
 		{"some-val", 200, `"some-val"`, true},
 		{"another-val", 201, `"another-val"`, true},
-		{4, rand.Intn(401) + 100, "4", true},
-		{map[string]interface{}{"foo": "bar", "baz": 6}, rand.Intn(401) + 100, `{"baz":6,"foo":"bar"}`, true},
-		{0.254, rand.Intn(401) + 100, "0.254", true},
-		{0.254, rand.Intn(401) + 100, "0.254", true},
+		{4, randStatusWithBody(), "4", true},
+		{map[string]interface{}{"foo": "bar", "baz": 6}, randStatusWithBody(), `{"baz":6,"foo":"bar"}`, true},
+		{0.254, randStatusWithBody(), "0.254", true},
+		{0.254, randStatusWithBody(), "0.254", true},
 		{math.Inf(1), 0, "", false},
 		// Prob can add more failing cases
 	}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"bufio"
+	"github.com/Gamma169/go-server-helpers/server"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+/*********************************************
+ * Helpers
+ * *******************************************/
+
+// A ResponseWriter that only implements the bare http.ResponseWriter interface
+type bareResponseWriter struct {
+	header http.Header
+}
+
+func (b *bareResponseWriter) Header() http.Header         { return b.header }
+func (b *bareResponseWriter) Write(d []byte) (int, error) { return len(d), nil }
+func (b *bareResponseWriter) WriteHeader(int)             {}
+
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+/*********************************************
+ * Tests
+ * *******************************************/
+
+func TestWrappedResponseWriterRecordsStatusAndSize(t *testing.T) {
+	testCases := []struct {
+		status      int
+		body        string
+		writeHeader bool
+	}{
+		{http.StatusOK, randString(100), true},
+		{http.StatusCreated, randString(100), true},
+		{http.StatusInternalServerError, randString(100), true},
+		{http.StatusNotFound, "", true},
+		// Writing without calling WriteHeader should record a 200
+		{http.StatusOK, randString(100), false},
+		// Writing nothing should also record a 200
+		{http.StatusOK, "", false},
+	}
+
+	for _, tc := range testCases {
+		recorder := httptest.NewRecorder()
+		wrapped := server.NewWrappedResponseWriter(recorder)
+
+		if tc.writeHeader {
+			wrapped.WriteHeader(tc.status)
+			// Superfluous calls should be ignored just like the standard library
+			wrapped.WriteHeader(http.StatusTeapot)
+		}
+		if tc.body != "" {
+			_, err := wrapped.Write([]byte(tc.body))
+			ok(t, err)
+		}
+
+		equals(t, tc.status, wrapped.Status())
+		equals(t, len(tc.body), wrapped.BytesWritten())
+		equals(t, tc.body, recorder.Body.String())
+		equals(t, tc.writeHeader || tc.body != "", wrapped.WroteHeader())
+		if tc.writeHeader || tc.body != "" {
+			assert(t, wrapped.TimeToFirstByte() <= wrapped.Duration(), "Time to first byte should be within the request duration")
+			equals(t, tc.status, recorder.Code)
+		} else {
+			equals(t, time.Duration(0), wrapped.TimeToFirstByte())
+		}
+	}
+}
+
+func TestWrappedResponseWriterSkipsInformationalStatus(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	wrapped := server.NewWrappedResponseWriter(recorder)
+
+	// FUNCTION TO TEST:
+	wrapped.WriteHeader(http.StatusEarlyHints)
+	assert(t, !wrapped.WroteHeader(), "1xx should not count as the final status")
+	wrapped.WriteHeader(http.StatusCreated)
+
+	equals(t, http.StatusCreated, wrapped.Status())
+	assert(t, wrapped.WroteHeader(), "The status after the 1xx is the final status")
+}
+
+func TestWrappedResponseWriterOptionalInterfaces(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	var wrapped http.ResponseWriter = server.NewWrappedResponseWriter(recorder)
+
+	flusher, isFlusher := wrapped.(http.Flusher)
+	assert(t, isFlusher, "Should implement http.Flusher")
+	flusher.Flush()
+	assert(t, recorder.Flushed, "Should flush underlying writer")
+
+	_, isPusher := wrapped.(http.Pusher)
+	assert(t, isPusher, "Should implement http.Pusher")
+
+	hijackable := &hijackableRecorder{ResponseRecorder: httptest.NewRecorder()}
+	hijackWrapped := server.NewWrappedResponseWriter(hijackable)
+	_, _, err := hijackWrapped.Hijack()
+	ok(t, err)
+	assert(t, hijackable.hijacked, "Should hijack underlying writer")
+	equals(t, http.StatusSwitchingProtocols, hijackWrapped.Status())
+
+	// Underlying writer without the optional interfaces should not panic
+	bare := server.NewWrappedResponseWriter(&bareResponseWriter{header: http.Header{}})
+	bare.Flush()
+	_, _, err = bare.Hijack()
+	assert(t, err != nil, "Should error when underlying writer cannot hijack")
+	equals(t, http.ErrNotSupported, bare.Push("/"+randString(25), nil))
+}
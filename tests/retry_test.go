@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/Gamma169/go-server-helpers/retry"
+	"testing"
+	"time"
+)
+
+/*********************************************
+ * Tests
+ * *******************************************/
+
+func TestRetryDo(t *testing.T) {
+	testCases := []struct {
+		maxAttempts      int
+		failTimes        int
+		expectedAttempts int
+		shouldPass       bool
+	}{
+		{5, 0, 1, true},
+		{5, 4, 5, true},
+		{5, 5, 5, false},
+		{1, 1, 1, false},
+		{0, 20, 21, true},
+	}
+
+	for _, tc := range testCases {
+		attempts := 0
+		var lastErr error
+		policy := retry.Policy{MaxAttempts: tc.maxAttempts, InitialDelay: time.Microsecond}
+
+		// FUNCTION TO TEST:
+		err := retry.Do(context.Background(), policy, func(ctx context.Context) error {
+			attempts++
+			if attempts <= tc.failTimes {
+				lastErr = errors.New(randString(20))
+				return lastErr
+			}
+			return nil
+		})
+
+		equals(t, tc.expectedAttempts, attempts)
+		if tc.shouldPass {
+			ok(t, err)
+		} else {
+			equals(t, lastErr, err)
+		}
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	permanent := errors.New("permanent")
+	attempts := 0
+	policy := retry.Policy{
+		MaxAttempts:  5,
+		InitialDelay: time.Microsecond,
+		Retryable:    func(err error) bool { return err != permanent },
+	}
+
+	// FUNCTION TO TEST:
+	err := retry.Do(context.Background(), policy, func(ctx context.Context) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("temporary")
+		}
+		return permanent
+	})
+	equals(t, permanent, err)
+	equals(t, 2, attempts)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	testCases := []struct {
+		jitter   retry.Jitter
+		expected func(attempt int, lastDelay time.Duration) (min time.Duration, max time.Duration)
+	}{
+		{retry.NoJitter, func(attempt int, _ time.Duration) (time.Duration, time.Duration) {
+			delay := []time.Duration{10, 20, 40, 50, 50, 50}[attempt-1] * time.Millisecond
+			return delay, delay
+		}},
+		{retry.FullJitter, func(attempt int, _ time.Duration) (time.Duration, time.Duration) {
+			return 0, []time.Duration{10, 20, 40, 50, 50, 50}[attempt-1] * time.Millisecond
+		}},
+		{retry.DecorrelatedJitter, func(attempt int, lastDelay time.Duration) (time.Duration, time.Duration) {
+			max := 3 * lastDelay
+			if max < 10*time.Millisecond {
+				max = 10 * time.Millisecond
+			}
+			if max > 50*time.Millisecond {
+				max = 50 * time.Millisecond
+			}
+			return 10 * time.Millisecond, max
+		}},
+	}
+
+	for _, tc := range testCases {
+		ctx, cancel := context.WithCancel(context.Background())
+		var lastDelay time.Duration
+		attempts := 0
+		policy := retry.Policy{
+			InitialDelay: 10 * time.Millisecond,
+			MaxDelay:     50 * time.Millisecond,
+			Jitter:       tc.jitter,
+			OnRetry: func(attempt int, err error, delay time.Duration) {
+				attempts++
+				equals(t, attempts, attempt)
+				min, max := tc.expected(attempt, lastDelay)
+				assert(t, delay >= min && delay <= max, "Jitter %d attempt %d: delay %s should be between %s and %s", tc.jitter, attempt, delay, min, max)
+				lastDelay = delay
+				if attempt == 6 {
+					cancel()
+				}
+			},
+		}
+
+		// FUNCTION TO TEST:
+		err := retry.Do(ctx, policy, func(ctx context.Context) error { return errors.New("fail") })
+		assert(t, err != nil, "Should return the error once cancelled")
+		equals(t, 6, attempts)
+		cancel()
+	}
+}
+
+func TestRetryStopsOnContextAndElapsed(t *testing.T) {
+	failing := func(ctx context.Context) error { return errors.New("fail") }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// FUNCTION TO TEST:
+	err := retry.Do(ctx, retry.DefaultPolicy(), failing)
+	equals(t, context.Canceled, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = retry.Do(ctx, retry.Policy{InitialDelay: time.Hour}, failing)
+	assert(t, err != nil && err.Error() == "fail", "Should return the last error when the context is done: %v", err)
+	assert(t, time.Since(start) < time.Second, "Should stop waiting when the context is done")
+
+	start = time.Now()
+	err = retry.Do(context.Background(), retry.Policy{InitialDelay: time.Hour, MaxElapsed: time.Minute}, failing)
+	assert(t, err != nil, "Should return the error")
+	assert(t, time.Since(start) < time.Second, "Should not start a wait that ends after MaxElapsed")
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"github.com/Gamma169/go-server-helpers/db"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*********************************************
+ * Helpers
+ * *******************************************/
+
+func queryFake(t *testing.T, columns []string, rows ...[]driver.Value) *sql.Rows {
+	dbConn := sql.OpenDB(fakeConnector{&fakeDatabase{columns: columns, rows: rows}})
+	t.Cleanup(func() { dbConn.Close() })
+	result, err := dbConn.Query("SELECT")
+	ok(t, err)
+	return result
+}
+
+type scanAudit struct {
+	CreatedAt time.Time
+	UpdatedBy *string
+}
+
+// Exported since embedded pointers to unexported types can't be allocated
+type ScanOwner struct {
+	OwnerId string
+}
+
+type scanUser struct {
+	Id        string
+	Email     string `db:"email_address"`
+	Nickname  sql.NullString
+	Age       *int64
+	DeletedAt *time.Time
+	HTTPPort  int
+	Internal  string `db:"-"`
+	scanAudit
+	*ScanOwner
+	hidden string
+}
+
+/*********************************************
+ * Tests
+ * *******************************************/
+
+func TestScanAll(t *testing.T) {
+	created := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	columns := []string{"id", "email_address", "nickname", "age", "deleted_at", "http_port", "created_at", "updated_by", "extra"}
+	rows := queryFake(t, columns,
+		[]driver.Value{"1", "a@example.com", "al", int64(30), created, int64(8080), created, "admin", "skipped"},
+		[]driver.Value{"2", "b@example.com", nil, nil, nil, int64(0), created, nil, nil},
+	)
+
+	// FUNCTION TO TEST:
+	users, err := db.ScanAll[scanUser](rows)
+	ok(t, err)
+
+	equals(t, 2, len(users))
+	equals(t, "1", users[0].Id)
+	equals(t, "a@example.com", users[0].Email)
+	equals(t, sql.NullString{String: "al", Valid: true}, users[0].Nickname)
+	equals(t, int64(30), *users[0].Age)
+	equals(t, created, *users[0].DeletedAt)
+	equals(t, 8080, users[0].HTTPPort)
+	equals(t, created, users[0].CreatedAt)
+	equals(t, "admin", *users[0].UpdatedBy)
+
+	equals(t, sql.NullString{}, users[1].Nickname)
+	assert(t, users[1].Age == nil && users[1].DeletedAt == nil && users[1].UpdatedBy == nil, "NULL should leave pointers nil")
+
+	// Embedded pointers are allocated for their columns
+	rows = queryFake(t, []string{"id", "owner_id"}, []driver.Value{"1", "owner"})
+	users, err = db.ScanAll[scanUser](rows)
+	ok(t, err)
+	equals(t, "owner", users[0].OwnerId)
+
+	rows = queryFake(t, columns)
+	users, err = db.ScanAll[scanUser](rows)
+	ok(t, err)
+	equals(t, []scanUser{}, users)
+}
+
+func TestScanAllStrict(t *testing.T) {
+	testCases := []struct {
+		column    string
+		expectErr bool
+	}{
+		{"id", false},
+		{"created_at", false},
+		{"extra", true},
+		{"internal", true},
+		{"hidden", true},
+		{"email", true},
+		{"owner_id", false},
+		{"scan_owner", true},
+	}
+
+	for _, tc := range testCases {
+		rows := queryFake(t, []string{tc.column})
+
+		// FUNCTION TO TEST:
+		_, err := db.ScanAll[scanUser](rows, db.Strict)
+
+		if tc.expectErr {
+			assert(t, err != nil && strings.Contains(err.Error(), tc.column), "Should report column %s: %v", tc.column, err)
+		} else {
+			ok(t, err)
+		}
+	}
+}
+
+func TestScanOne(t *testing.T) {
+	rows := queryFake(t, []string{"id", "email_address"}, []driver.Value{"1", "a@example.com"})
+
+	// FUNCTION TO TEST:
+	user, err := db.ScanOne[scanUser](rows)
+	ok(t, err)
+	equals(t, "a@example.com", user.Email)
+
+	rows = queryFake(t, []string{"id", "email_address"}, []driver.Value{"1", "a@example.com"}, []driver.Value{"2", "b@example.com"})
+	_, err = db.ScanOne[scanUser](rows)
+	equals(t, db.ErrMultipleRows, err)
+
+	_, err = db.ScanOne[scanUser](queryFake(t, []string{"id"}))
+	equals(t, sql.ErrNoRows, err)
+
+	// NULL into a plain field is an error rather than a silent zero value
+	_, err = db.ScanOne[scanUser](queryFake(t, []string{"id"}, []driver.Value{nil}))
+	assert(t, err != nil, "Should return an error for NULL into a string")
+
+	_, err = db.ScanOne[int](queryFake(t, []string{"id"}, []driver.Value{int64(1)}))
+	assert(t, err != nil, "Should only scan into structs")
+}
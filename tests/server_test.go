@@ -1,9 +1,35 @@
 package tests
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/Gamma169/go-server-helpers/logging"
+	"github.com/Gamma169/go-server-helpers/server"
+	"github.com/gorilla/mux"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
+/*********************************************
+ * Helpers
+ * *******************************************/
+
+func waitUntil(t *testing.T, condition func() bool, msg string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
 /*********************************************
  * Tests
  * *******************************************/
@@ -12,6 +38,206 @@ func TestSetupAndRunServer(t *testing.T) {
 	t.Skip("TODO")
 }
 
+func TestRunShutsDownInOrderWhenContextCancelled(t *testing.T) {
+	readiness := server.NewReadiness()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var order []string
+	hook := func(name string) server.ShutdownHook {
+		return server.ShutdownHook{Name: name, Fn: func(context.Context) error {
+			// Readiness must already be off and servers shut down when hooks run
+			if readiness.IsReady() {
+				order = append(order, "still-ready")
+			}
+			order = append(order, name)
+			return nil
+		}}
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- server.Run(ctx, server.RunConfig{
+			Servers:     []*http.Server{server.NewServerFromRouter(mux.NewRouter(), "0", time.Second), server.NewServerFromRouter(mux.NewRouter(), "0", time.Second)},
+			Readiness:   readiness,
+			DrainPeriod: 10 * time.Millisecond,
+			Hooks:       []server.ShutdownHook{hook("first"), hook("second")},
+		})
+	}()
+
+	waitUntil(t, readiness.IsReady, "Should mark ready once servers start")
+	cancel()
+
+	select {
+	case err := <-done:
+		ok(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after context was cancelled")
+	}
+	assert(t, !readiness.IsReady(), "Should not be ready after shutdown")
+	equals(t, []string{"first", "second"}, order)
+}
+
+func TestRunShutsDownOnSIGTERM(t *testing.T) {
+	readiness := server.NewReadiness()
+	hookCalled := false
+
+	done := make(chan error)
+	go func() {
+		done <- server.Run(context.Background(), server.RunConfig{
+			Readiness: readiness,
+			Hooks: []server.ShutdownHook{{Name: "hook", Fn: func(context.Context) error {
+				hookCalled = true
+				return nil
+			}}},
+		})
+	}()
+
+	// Readiness is set after the signal handler is registered, so it is safe to send the signal
+	waitUntil(t, readiness.IsReady, "Should mark ready once servers start")
+	ok(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+
+	select {
+	case err := <-done:
+		ok(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after SIGTERM")
+	}
+	assert(t, hookCalled, "Should run shutdown hooks")
+}
+
+func TestRunReturnsHookErrors(t *testing.T) {
+	hookErr := errors.New(randString(30))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	lastHookCalled := false
+	err := server.Run(ctx, server.RunConfig{
+		Hooks: []server.ShutdownHook{
+			{Name: "fails", Fn: func(context.Context) error { return hookErr }},
+			// Ignores its context, so it should be abandoned after the timeout
+			{Name: "hangs", Timeout: 10 * time.Millisecond, Fn: func(context.Context) error {
+				time.Sleep(time.Second)
+				return nil
+			}},
+			{Name: "last", Fn: func(context.Context) error {
+				lastHookCalled = true
+				return nil
+			}},
+		},
+	})
+
+	assert(t, err != nil, "Should return hook errors")
+	assert(t, errors.Is(err, hookErr), "Should contain the hook error")
+	assert(t, errors.Is(err, context.DeadlineExceeded), "Should contain the timeout error")
+	assert(t, lastHookCalled, "Should still run hooks after one fails")
+}
+
+func TestRunWaitsForHooksWithoutTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	finished := false
+	err := server.Run(ctx, server.RunConfig{
+		Hooks: []server.ShutdownHook{{Name: "slow", Timeout: -1, Fn: func(ctx context.Context) error {
+			_, hasDeadline := ctx.Deadline()
+			assert(t, !hasDeadline, "Should not have a deadline")
+			time.Sleep(50 * time.Millisecond)
+			finished = true
+			return nil
+		}}},
+	})
+
+	ok(t, err)
+	assert(t, finished, "Should wait for the hook to finish")
+}
+
+func TestCreateAndRunServerFromRouter(t *testing.T) {
+	var buf bytes.Buffer
+	defer logging.SetDefault(logging.Default())
+	logging.SetDefault(logging.New(logging.NewJSONSink(&buf), logging.LevelInfo))
+
+	router := mux.NewRouter()
+	router.Path("/ping").HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+
+	// FUNCTION TO TEST:
+	srv, serveErrs, err := server.CreateAndRunServerFromRouter(router, "0", time.Second, false)
+	ok(t, err)
+	assert(t, strings.Contains(buf.String(), "Ready to accept connections"), "Should log ready once listening")
+
+	// The socket is already listening when the function returns
+	_, port, err := net.SplitHostPort(srv.Addr)
+	ok(t, err)
+	resp, err := http.Get("http://127.0.0.1:" + port + "/ping")
+	ok(t, err)
+	resp.Body.Close()
+	equals(t, http.StatusTeapot, resp.StatusCode)
+
+	// Binding the same port again should return an error instead of panicking
+	buf.Reset()
+	_, _, err = server.CreateAndRunServerFromRouter(mux.NewRouter(), port, time.Second, false)
+	assert(t, err != nil, "Should return error when port is taken")
+	assert(t, !strings.Contains(buf.String(), "Ready to accept connections"), "Should not log ready when bind fails")
+
+	ok(t, srv.Shutdown(context.Background()))
+	_, open := <-serveErrs
+	assert(t, !open, "Should close the error channel without an error after shutdown")
+}
+
+func TestRunReturnsBindErrors(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	ok(t, err)
+	defer listener.Close()
+
+	first := server.NewServerFromRouter(mux.NewRouter(), "0", time.Second)
+	taken := &http.Server{Addr: listener.Addr().String()}
+	hookCalled := false
+
+	done := make(chan error)
+	go func() {
+		done <- server.Run(context.Background(), server.RunConfig{
+			Servers: []*http.Server{first, taken},
+			Hooks: []server.ShutdownHook{{Name: "hook", Fn: func(context.Context) error {
+				hookCalled = true
+				return nil
+			}}},
+		})
+	}()
+
+	select {
+	case err := <-done:
+		assert(t, err != nil, "Should return the bind error")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return when a port was taken")
+	}
+	assert(t, !hookCalled, "Should not run shutdown hooks when startup fails")
+	// The server that did start should be closed
+	_, err = http.Get("http://" + first.Addr)
+	assert(t, err != nil, "Should close servers that started before the failure")
+}
+
+func TestSetupAndRunServerPanicsOnBindErrors(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	ok(t, err)
+	defer listener.Close()
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+	defer logging.SetDefault(logging.Default())
+	logging.SetDefault(logging.New(logging.NewJSONSink(&bytes.Buffer{}), logging.LevelDebug))
+
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		server.SetupAndRunServer(mux.NewRouter(), port, false, func() {})
+	}()
+
+	select {
+	case recovered := <-panicked:
+		assert(t, recovered != nil, "Should panic when the port is taken")
+	case <-time.After(5 * time.Second):
+		t.Fatal("SetupAndRunServer did not return when the port was taken")
+	}
+}
+
 func TestWalkRouter(t *testing.T) {
 	t.Skip("TODO")
 }
@@ -0,0 +1,415 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/Gamma169/go-server-helpers/db"
+	"github.com/Gamma169/go-server-helpers/logging"
+	"github.com/Gamma169/go-server-helpers/server"
+	"github.com/Gamma169/go-server-helpers/tracing"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*********************************************
+ * Helpers
+ * *******************************************/
+
+// Sets the default tracer to export to memory until the returned func is called
+func useInMemoryTracer() (*tracing.InMemoryExporter, func()) {
+	exporter := tracing.NewInMemoryExporter()
+	tracing.SetDefault(tracing.NewTracer("test-service", exporter))
+	return exporter, func() { tracing.SetDefault(tracing.NewTracer("", nil)) }
+}
+
+// Only has what every driver must have, plus a Validator and NamedValueChecker
+type legacyConnector struct{ conn *legacyConn }
+type legacyConn struct {
+	valid   bool
+	checked int
+	begun   int
+}
+type legacyTx struct{}
+
+func (c legacyConnector) Connect(context.Context) (driver.Conn, error) { return c.conn, nil }
+func (legacyConnector) Driver() driver.Driver                          { return nil }
+
+func (*legacyConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (*legacyConn) Close() error { return nil }
+func (c *legacyConn) Begin() (driver.Tx, error) {
+	c.begun++
+	return legacyTx{}, nil
+}
+func (c *legacyConn) IsValid() bool { return c.valid }
+func (c *legacyConn) CheckNamedValue(value *driver.NamedValue) error {
+	c.checked++
+	return driver.ErrSkip
+}
+func (*legacyConn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{}, nil
+}
+
+func (legacyTx) Commit() error   { return nil }
+func (legacyTx) Rollback() error { return nil }
+
+/*********************************************
+ * Tests
+ * *******************************************/
+
+func TestParseTraceparent(t *testing.T) {
+	testCases := []struct {
+		value     string
+		expectErr bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", false},
+		// Future versions can have more fields
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", true},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01", true},
+		{"", true},
+		{randString(55), true},
+	}
+
+	for _, tc := range testCases {
+		// FUNCTION TO TEST:
+		sc, err := tracing.ParseTraceparent(tc.value)
+		if tc.expectErr {
+			equals(t, tracing.ErrInvalidTraceparent, err)
+			continue
+		}
+		ok(t, err)
+		assert(t, sc.IsValid(), "Should be valid: %s", tc.value)
+		assert(t, sc.Remote, "Should be marked remote")
+		equals(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+		equals(t, "00f067aa0ba902b7", sc.SpanID.String())
+		equals(t, strings.HasSuffix(tc.value[:55], "01"), sc.IsSampled())
+		if strings.HasPrefix(tc.value, "00") {
+			equals(t, tc.value, sc.Traceparent())
+		}
+	}
+}
+
+func TestTracerStartAndPropagation(t *testing.T) {
+	exporter, reset := useInMemoryTracer()
+	defer reset()
+
+	header := http.Header{}
+	header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Add(tracing.TracestateHeader, "vendor=abc")
+	header.Add(tracing.TracestateHeader, "other=xyz")
+
+	// FUNCTIONS TO TEST:
+	ctx := tracing.Extract(context.Background(), header)
+	ctx, parent := tracing.Default().Start(ctx, "parent", tracing.SpanKindServer)
+	childCtx, child := tracing.Default().Start(ctx, "child", tracing.SpanKindInternal)
+	child.SetAttribute("key", "value")
+	child.RecordError(errors.New("broken"))
+	child.End()
+	child.End()
+	parent.End()
+
+	outgoing := http.Header{}
+	tracing.Inject(childCtx, outgoing)
+	equals(t, child.SpanContext().Traceparent(), outgoing.Get(tracing.TraceparentHeader))
+	equals(t, "vendor=abc,other=xyz", outgoing.Get(tracing.TracestateHeader))
+
+	spans := exporter.Spans()
+	equals(t, 2, len(spans))
+	equals(t, "child", spans[0].Name)
+	equals(t, "parent", spans[1].Name)
+	equals(t, "test-service", spans[0].ServiceName)
+	equals(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[1].SpanContext.TraceID.String())
+	equals(t, "00f067aa0ba902b7", spans[1].ParentSpanID.String())
+	equals(t, spans[1].SpanContext.TraceID, spans[0].SpanContext.TraceID)
+	equals(t, spans[1].SpanContext.SpanID, spans[0].ParentSpanID)
+	equals(t, "value", spans[0].Attributes["key"])
+	equals(t, tracing.StatusError, spans[0].Status)
+	equals(t, 1, len(spans[0].Events))
+	equals(t, "exception", spans[0].Events[0].Name)
+	assert(t, !spans[0].EndTime.Before(spans[0].StartTime), "Should end after starting")
+
+	// Unsampled traces are propagated but not exported
+	exporter.Reset()
+	header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span := tracing.Default().Start(tracing.Extract(context.Background(), header), "unsampled", tracing.SpanKindServer)
+	span.End()
+	equals(t, 0, len(exporter.Spans()))
+
+	// No parent starts a new trace
+	_, root := tracing.Default().Start(context.Background(), "root", tracing.SpanKindInternal)
+	assert(t, root.SpanContext().IsValid(), "Should generate ids")
+	root.End()
+	assert(t, !exporter.Spans()[0].ParentSpanID.IsValid(), "Root span should not have a parent")
+}
+
+func TestOTLPJSONExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := tracing.NewTracer("my-service", tracing.NewOTLPJSONExporter(&buf))
+	_, span := tracer.Start(context.Background(), "op", tracing.SpanKindClient)
+	span.SetAttribute("count", 3)
+	span.End()
+
+	var payload struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string
+					Value map[string]interface{}
+				}
+			}
+			ScopeSpans []struct {
+				Spans []map[string]interface{}
+			}
+		}
+	}
+	ok(t, json.Unmarshal(buf.Bytes(), &payload))
+	equals(t, "service.name", payload.ResourceSpans[0].Resource.Attributes[0].Key)
+	equals(t, "my-service", payload.ResourceSpans[0].Resource.Attributes[0].Value["stringValue"])
+	otlpSpan := payload.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	equals(t, "op", otlpSpan["name"])
+	equals(t, float64(tracing.SpanKindClient), otlpSpan["kind"])
+	equals(t, span.SpanContext().TraceID.String(), otlpSpan["traceId"])
+	equals(t, span.SpanContext().SpanID.String(), otlpSpan["spanId"])
+	_, hasParent := otlpSpan["parentSpanId"]
+	assert(t, !hasParent, "Root span should not have a parent")
+	equals(t, "{\"intValue\":\"3\"}", mustMarshal(t, otlpSpan["attributes"].([]interface{})[0].(map[string]interface{})["value"]))
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	ok(t, err)
+	return string(b)
+}
+
+func TestAddTracingMiddleware(t *testing.T) {
+	exporter, reset := useInMemoryTracer()
+	defer reset()
+	traceIdHeader := randString(25)
+	legacyId := uuid.New()
+
+	testCases := []struct {
+		traceparent     string
+		legacy          string
+		status          int
+		expectedTraceId string
+		expectedParent  string
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", http.StatusOK, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		// traceparent wins over the legacy header
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", legacyId.String(), http.StatusOK, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{"", legacyId.String(), http.StatusInternalServerError, strings.ReplaceAll(legacyId.String(), "-", ""), ""},
+		{"garbage", "not-a-uuid", http.StatusNotFound, "", ""},
+	}
+
+	for _, tc := range testCases {
+		exporter.Reset()
+		router := mux.NewRouter()
+		var contextTraceId uuid.UUID
+		var handlerSpan *tracing.Span
+		router.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			contextTraceId, _ = server.TraceIDFromContext(r.Context())
+			handlerSpan = tracing.SpanFromContext(r.Context())
+			w.WriteHeader(tc.status)
+		}).Methods("GET")
+		// FUNCTION TO TEST:
+		server.AddTracingMiddleware(router, traceIdHeader)
+
+		req := httptest.NewRequest("GET", "/users/"+randString(10), nil)
+		if tc.traceparent != "" {
+			req.Header.Set(tracing.TraceparentHeader, tc.traceparent)
+		}
+		if tc.legacy != "" {
+			req.Header.Set(traceIdHeader, tc.legacy)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		spans := exporter.Spans()
+		equals(t, 1, len(spans))
+		span := spans[0]
+		equals(t, "GET /users/{id}", span.Name)
+		equals(t, tracing.SpanKindServer, span.Kind)
+		equals(t, "/users/{id}", span.Attributes["http.route"])
+		equals(t, tc.status, span.Attributes["http.response.status_code"])
+		equals(t, handlerSpan.SpanContext(), span.SpanContext)
+		if tc.expectedTraceId != "" {
+			equals(t, tc.expectedTraceId, span.SpanContext.TraceID.String())
+		}
+		if tc.expectedParent != "" {
+			equals(t, tc.expectedParent, span.ParentSpanID.String())
+		} else {
+			assert(t, !span.ParentSpanID.IsValid(), "Should not have a parent span")
+		}
+		// The legacy trace id is the same trace id as a UUID
+		equals(t, span.SpanContext.TraceID.String(), strings.ReplaceAll(contextTraceId.String(), "-", ""))
+		// A trace id the caller sent is echoed as is
+		if tc.legacy != "" {
+			equals(t, tc.legacy, recorder.Result().Header.Get(traceIdHeader))
+		} else {
+			equals(t, contextTraceId.String(), recorder.Result().Header.Get(traceIdHeader))
+		}
+		if tc.status >= 500 {
+			equals(t, tracing.StatusError, span.Status)
+		} else {
+			equals(t, tracing.StatusUnset, span.Status)
+		}
+	}
+}
+
+func TestAddTracingMiddlewareWithLogging(t *testing.T) {
+	_, reset := useInMemoryTracer()
+	defer reset()
+	traceIdHeader := randString(25)
+
+	var buf bytes.Buffer
+	defer logging.SetDefault(logging.Default())
+	logging.SetDefault(logging.New(logging.NewJSONSink(&buf), logging.LevelInfo))
+
+	router := mux.NewRouter()
+	var span *tracing.Span
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		span = tracing.SpanFromContext(r.Context())
+	})
+	// FUNCTIONS TO TEST:
+	server.AddTracingMiddleware(router, traceIdHeader)
+	server.AddLoggingMiddleware(router, traceIdHeader, false)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	var finished map[string]interface{}
+	ok(t, json.Unmarshal(buf.Bytes(), &finished))
+	equals(t, "4bf92f35-77b3-4da6-a3ce-929d0e0e4736", finished[logging.FieldTraceId])
+	equals(t, span.SpanContext().SpanID.String(), finished[logging.FieldSpanId])
+}
+
+func TestPostgresTracing(t *testing.T) {
+	exporter, reset := useInMemoryTracer()
+	defer reset()
+
+	// FUNCTION TO TEST:
+	dbConn := sql.OpenDB(db.NewTracedConnector(fakeConnector{&fakeDatabase{}}))
+	defer dbConn.Close()
+
+	// Not traced without a span in the context
+	rows, err := dbConn.QueryContext(context.Background(), "SELECT 1")
+	ok(t, err)
+	rows.Close()
+	equals(t, 0, len(exporter.Spans()))
+
+	ctx, parent := tracing.Default().Start(context.Background(), "request", tracing.SpanKindServer)
+	rows, err = dbConn.QueryContext(ctx, "select * from users where id = $1", "secret-id")
+	ok(t, err)
+	rows.Close()
+	_, err = dbConn.ExecContext(ctx, "FAIL update users")
+	equals(t, errFakeQuery, err)
+	parent.End()
+
+	spans := exporter.Spans()
+	equals(t, 3, len(spans))
+	equals(t, "SELECT", spans[0].Name)
+	equals(t, tracing.SpanKindClient, spans[0].Kind)
+	equals(t, "postgresql", spans[0].Attributes["db.system"])
+	equals(t, "select * from users where id = $1", spans[0].Attributes["db.statement"])
+	equals(t, parent.SpanContext().SpanID, spans[0].ParentSpanID)
+	equals(t, parent.SpanContext().TraceID, spans[0].SpanContext.TraceID)
+	equals(t, tracing.StatusUnset, spans[0].Status)
+	equals(t, "FAIL", spans[1].Name)
+	equals(t, tracing.StatusError, spans[1].Status)
+	for _, span := range spans {
+		for _, value := range span.Attributes {
+			assert(t, value != "secret-id", "Should never record query args")
+		}
+	}
+}
+
+func TestPostgresTracingOptionalInterfaces(t *testing.T) {
+	exporter, reset := useInMemoryTracer()
+	defer reset()
+	inner := &legacyConn{valid: true}
+
+	// FUNCTION TO TEST:
+	conn, err := db.NewTracedConnector(legacyConnector{inner}).Connect(context.Background())
+	ok(t, err)
+
+	// Interfaces the driver doesn't implement are not claimed, and the ones it does are forwarded
+	_, isPinger := conn.(driver.Pinger)
+	assert(t, !isPinger, "Should not be a Pinger if the driver's conn is not")
+	_, isResetter := conn.(driver.SessionResetter)
+	assert(t, !isResetter, "Should not be a SessionResetter if the driver's conn is not")
+	inner.valid = false
+	assert(t, !conn.(driver.Validator).IsValid(), "Should forward IsValid")
+
+	innerDB := &legacyConn{valid: true}
+	dbConn := sql.OpenDB(db.NewTracedConnector(legacyConnector{innerDB}))
+	defer dbConn.Close()
+
+	ctx, parent := tracing.Default().Start(context.Background(), "request", tracing.SpanKindServer)
+	// The non-context Queryer is still used (and traced)
+	rows, err := dbConn.QueryContext(ctx, "SELECT 1", 1)
+	ok(t, err)
+	rows.Close()
+	parent.End()
+	equals(t, 1, innerDB.checked)
+	equals(t, 2, len(exporter.Spans()))
+
+	// Begin can't honor the options, so they are rejected instead of being dropped
+	_, err = dbConn.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+	assert(t, err != nil, "Should not begin a transaction with a non-default isolation level")
+	_, err = dbConn.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	assert(t, err != nil, "Should not begin a read-only transaction")
+	equals(t, 0, innerDB.begun)
+	tx, err := dbConn.BeginTx(context.Background(), nil)
+	ok(t, err)
+	ok(t, tx.Rollback())
+	equals(t, 1, innerDB.begun)
+}
+
+func TestRedisTracing(t *testing.T) {
+	exporter, reset := useInMemoryTracer()
+	defer reset()
+
+	redisClient := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer redisClient.Close()
+	// FUNCTION TO TEST:
+	redisClient.AddHook(db.NewRedisTracingHook())
+
+	redisClient.Get(context.Background(), "key")
+	equals(t, 0, len(exporter.Spans()))
+
+	ctx, parent := tracing.Default().Start(context.Background(), "request", tracing.SpanKindServer)
+	err := redisClient.Get(ctx, "key").Err()
+	assert(t, err != nil, "Should not connect to redis")
+	pipe := redisClient.Pipeline()
+	pipe.Get(ctx, "a")
+	pipe.Get(ctx, "b")
+	_, _ = pipe.Exec(ctx)
+	parent.End()
+
+	spans := exporter.Spans()
+	equals(t, 3, len(spans))
+	equals(t, "get", spans[0].Name)
+	equals(t, "redis", spans[0].Attributes["db.system"])
+	equals(t, parent.SpanContext().SpanID, spans[0].ParentSpanID)
+	equals(t, tracing.StatusError, spans[0].Status)
+	equals(t, "pipeline", spans[1].Name)
+	equals(t, 2, spans[1].Attributes["db.redis.num_cmds"])
+}
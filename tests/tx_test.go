@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/Gamma169/go-server-helpers/db"
+	"github.com/Gamma169/go-server-helpers/retry"
+	"github.com/lib/pq"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*********************************************
+ * Helpers
+ * *******************************************/
+
+// Commits fail with commitErrs, in order, before they succeed
+func newTxDB(commitErrs ...error) (*sql.DB, *fakeDatabase) {
+	fake := &fakeDatabase{commitErrs: commitErrs}
+	return sql.OpenDB(fakeConnector{fake}), fake
+}
+
+// Savepoint names are unique across the process, so replace them with a placeholder
+func withoutSavepointNames(log string) string {
+	parts := strings.Split(log, "; ")
+	for i, part := range parts {
+		if idx := strings.Index(part, "sp_"); idx >= 0 {
+			parts[i] = part[:idx] + "sp"
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+/*********************************************
+ * Tests
+ * *******************************************/
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	fnErr := errors.New("fn failed")
+	testCases := []struct {
+		fn          func(tx *sql.Tx) error
+		expectedErr error
+		expectedLog string
+	}{
+		{func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "UPDATE a")
+			return err
+		}, nil, "BEGIN; UPDATE a; COMMIT"},
+		{func(tx *sql.Tx) error {
+			tx.ExecContext(ctx, "UPDATE a")
+			return fnErr
+		}, fnErr, "BEGIN; UPDATE a; ROLLBACK"},
+		{func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "FAIL")
+			return err
+		}, errFakeQuery, "BEGIN; FAIL; ROLLBACK"},
+	}
+
+	for _, tc := range testCases {
+		dbConn, rec := newTxDB()
+
+		// FUNCTION TO TEST:
+		err := db.WithTx(ctx, dbConn, nil, tc.fn)
+
+		equals(t, tc.expectedErr, err)
+		equals(t, tc.expectedLog, rec.log())
+		dbConn.Close()
+	}
+}
+
+func TestWithTxOptionsAndPanic(t *testing.T) {
+	dbConn, rec := newTxDB()
+	defer dbConn.Close()
+
+	func() {
+		defer func() {
+			equals(t, "boom", recover())
+		}()
+		// FUNCTION TO TEST:
+		db.WithTx(context.Background(), dbConn, &db.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true}, func(tx *sql.Tx) error {
+			panic("boom")
+		})
+	}()
+
+	equals(t, "BEGIN; ROLLBACK", rec.log())
+	equals(t, []driver.TxOptions{{Isolation: driver.IsolationLevel(sql.LevelSerializable), ReadOnly: true}}, rec.txOptions)
+}
+
+func TestWithTxRetries(t *testing.T) {
+	serialization := &pq.Error{Code: "40001"}
+	deadlock := &pq.Error{Code: "40P01"}
+	policy := &retry.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond}
+
+	dbConn, rec := newTxDB(serialization, deadlock)
+	calls := 0
+	// FUNCTION TO TEST:
+	err := db.WithTx(context.Background(), dbConn, &db.TxOptions{Retry: policy}, func(tx *sql.Tx) error {
+		calls++
+		return nil
+	})
+	ok(t, err)
+	equals(t, 3, calls)
+	equals(t, "BEGIN; COMMIT; BEGIN; COMMIT; BEGIN; COMMIT", rec.log())
+	dbConn.Close()
+
+	// Gives up after MaxAttempts
+	dbConn, _ = newTxDB(serialization, serialization, serialization)
+	err = db.WithTx(context.Background(), dbConn, &db.TxOptions{Retry: policy}, func(tx *sql.Tx) error { return nil })
+	equals(t, serialization, err)
+	dbConn.Close()
+
+	// Other errors are not retried
+	dbConn, _ = newTxDB()
+	calls = 0
+	err = db.WithTx(context.Background(), dbConn, &db.TxOptions{Retry: policy}, func(tx *sql.Tx) error {
+		calls++
+		return &pq.Error{Code: "23505"}
+	})
+	assert(t, err != nil && !db.IsRetryableTxError(err), "Should return the unique violation: %v", err)
+	equals(t, 1, calls)
+	dbConn.Close()
+}
+
+func TestWithSavepoint(t *testing.T) {
+	ctx := context.Background()
+	dbConn, rec := newTxDB()
+	defer dbConn.Close()
+	innerErr := errors.New("inner failed")
+
+	err := db.WithTx(ctx, dbConn, nil, func(tx *sql.Tx) error {
+		// FUNCTION TO TEST:
+		err := db.WithSavepoint(ctx, tx, func(tx *sql.Tx) error {
+			tx.ExecContext(ctx, "UPDATE a")
+			return db.WithSavepoint(ctx, tx, func(tx *sql.Tx) error {
+				tx.ExecContext(ctx, "UPDATE b")
+				return innerErr
+			})
+		})
+		equals(t, innerErr, err)
+		return db.WithSavepoint(ctx, tx, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "UPDATE c")
+			return err
+		})
+	})
+	ok(t, err)
+
+	expected := "BEGIN; SAVEPOINT sp; UPDATE a; SAVEPOINT sp; UPDATE b; ROLLBACK TO SAVEPOINT sp; ROLLBACK TO SAVEPOINT sp; " +
+		"SAVEPOINT sp; UPDATE c; RELEASE SAVEPOINT sp; COMMIT"
+	equals(t, expected, withoutSavepointNames(rec.log()))
+}
@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Gamma169/go-server-helpers/server"
+	"github.com/google/uuid"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*********************************************
+ * Helpers
+ * *******************************************/
+
+type validatedAddress struct {
+	Street string `json:"street" validate:"required"`
+	Zip    string `json:"zip"    validate:"omitempty,min=5,max=5"`
+}
+
+type validatedItem struct {
+	Id  string `json:"id"  validate:"required,uuid"`
+	Qty int    `json:"qty" validate:"min=1,max=100"`
+}
+
+type ValidatedBase struct {
+	Kind string `json:"kind" validate:"oneof=person company"`
+}
+
+type validatedInput struct {
+	ValidatedBase
+	Name     string            `json:"name"     validate:"required,min=3,max=10"`
+	Email    string            `json:"email"    validate:"omitempty,email"`
+	Tags     []string          `json:"tags"     validate:"max=2"`
+	Address  *validatedAddress `json:"address"  validate:"required"`
+	Items    []validatedItem   `json:"items"`
+	Ignored  string            `json:"-"        validate:"required"`
+	validate func() error
+}
+
+func (v *validatedInput) Validate() error {
+	if v.validate == nil {
+		return nil
+	}
+	return v.validate()
+}
+
+func validInput() validatedInput {
+	return validatedInput{
+		ValidatedBase: ValidatedBase{Kind: "person"},
+		Name:          "abcde",
+		Email:         "someone@example.com",
+		Tags:          []string{"a"},
+		Address:       &validatedAddress{Street: "Main st", Zip: "12345"},
+		Items:         []validatedItem{{Id: uuid.New().String(), Qty: 3}},
+	}
+}
+
+func fieldsOf(errs server.ValidationErrors) []string {
+	fields := []string{}
+	for _, e := range errs {
+		fields = append(fields, e.Field+":"+e.Code)
+	}
+	return fields
+}
+
+/*********************************************
+ * Tests
+ * *******************************************/
+
+func TestValidateStruct(t *testing.T) {
+	testCases := []struct {
+		modify   func(*validatedInput)
+		expected []string
+	}{
+		{func(v *validatedInput) {}, []string{}},
+		{func(v *validatedInput) { v.Name = "" }, []string{"name:required"}},
+		{func(v *validatedInput) { v.Name = "ab" }, []string{"name:min"}},
+		{func(v *validatedInput) { v.Name = "abcdefghijk" }, []string{"name:max"}},
+		// Length is counted in characters, not bytes
+		{func(v *validatedInput) { v.Name = "日本語日本語" }, []string{}},
+		{func(v *validatedInput) { v.Email = "" }, []string{}},
+		{func(v *validatedInput) { v.Email = "not-an-email" }, []string{"email:email"}},
+		{func(v *validatedInput) { v.Email = "Someone <someone@example.com>" }, []string{"email:email"}},
+		{func(v *validatedInput) { v.Kind = "robot" }, []string{"kind:oneof"}},
+		{func(v *validatedInput) { v.Tags = []string{"a", "b", "c"} }, []string{"tags:max"}},
+		{func(v *validatedInput) { v.Address = nil }, []string{"address:required"}},
+		{func(v *validatedInput) { v.Address.Street = "" }, []string{"address.street:required"}},
+		{func(v *validatedInput) { v.Address.Zip = "123" }, []string{"address.zip:min"}},
+		{func(v *validatedInput) {
+			v.Items = append(v.Items, validatedItem{Id: "not-uuid", Qty: 0}, validatedItem{Qty: 101})
+		}, []string{"items[1].id:uuid", "items[1].qty:min", "items[2].id:required", "items[2].qty:max"}},
+		{func(v *validatedInput) { v.Name = ""; v.Kind = "" }, []string{"kind:oneof", "name:required"}},
+	}
+
+	for _, tc := range testCases {
+		input := validInput()
+		tc.modify(&input)
+
+		// Should work for pointers and values
+		equals(t, tc.expected, fieldsOf(server.ValidateStruct(&input)))
+		equals(t, tc.expected, fieldsOf(server.ValidateStruct(input)))
+	}
+	assert(t, server.ValidateStruct(validInput()) == nil, "Should return nil if there are no errors")
+}
+
+func TestValidateStructPanicsOnBadTag(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("ValidateStruct did not panic on unknown rule")
+		}
+	}()
+
+	server.ValidateStruct(struct {
+		Name string `validate:"not-a-rule"`
+	}{})
+}
+
+type badTagItem struct {
+	Name string `json:"name" validate:"requird"`
+}
+
+type badTagInput struct {
+	Items []*badTagItem `json:"items"`
+}
+
+func (*badTagInput) Validate() error { return nil }
+
+func TestHandlePanicsOnBadTag(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Handle did not panic on a bad tag of a nested struct")
+		}
+	}()
+
+	// Should panic when the handler is built, not on the first request
+	server.Handle(func(ctx context.Context, input *badTagInput) (*badTagInput, int, error) {
+		return input, http.StatusOK, nil
+	})
+}
+
+func TestPreProcessInputValidation(t *testing.T) {
+	validateErrStr := randString(30)
+	testCases := []struct {
+		body           string
+		validateErr    error
+		expectedFields []string
+		expectedErr    string
+	}{
+		{`{"name":"abcde","kind":"person","address":{"street":"a"}}`, nil, nil, ""},
+		// Tag errors only
+		{`{"name":"ab","kind":"person","address":{"street":"a"}}`, nil, []string{"name:min"}, ""},
+		// Plain errors from Validate() are returned as they were before
+		{`{"name":"abcde","kind":"person","address":{"street":"a"}}`, errors.New(validateErrStr), nil, validateErrStr},
+		// Validate() is not called if the tags fail
+		{`{"name":"ab","kind":"person","address":{"street":"a"}}`, errors.New(validateErrStr), []string{"name:min"}, ""},
+		{`{"name":"ab","kind":"person","address":{"street":"a"}}`, server.ValidationErrors{{Field: "name", Code: "taken", Message: "is taken"}}, []string{"name:min"}, ""},
+		{`{"name":"abcde","kind":"person","address":{"street":"a"}}`, server.ValidationErrors{{Field: "name", Code: "taken", Message: "is taken"}}, []string{"name:taken"}, ""},
+	}
+
+	for _, tc := range testCases {
+		req, err := http.NewRequest("POST", "/"+randString(25), strings.NewReader(tc.body))
+		ok(t, err)
+
+		input := validatedInput{validate: func() error { return tc.validateErr }}
+		err = server.PreProcessInputFromJSON(&input, 0, httptest.NewRecorder(), req)
+
+		if tc.expectedFields != nil {
+			var validationErrs server.ValidationErrors
+			assert(t, errors.As(err, &validationErrs), "Should return ValidationErrors, got: %v", err)
+			equals(t, tc.expectedFields, fieldsOf(validationErrs))
+		} else if tc.expectedErr != "" {
+			equals(t, tc.expectedErr, err.Error())
+		} else {
+			ok(t, err)
+		}
+	}
+}
+
+func TestStandardJSONRequestHandlerValidationResponse(t *testing.T) {
+	body := fmt.Sprintf(`{"name":"ab","kind":"robot","address":{"street":""},"items":[{"id":"%s","qty":1},{"id":"bad","qty":1}]}`, uuid.New().String())
+	req, err := http.NewRequest("POST", "/"+randString(25), strings.NewReader(body))
+	ok(t, err)
+	recorder := httptest.NewRecorder()
+
+	logicCalled := false
+	logicFunc := func(i server.InputObject, r *http.Request) (interface{}, int, error) {
+		logicCalled = true
+		return nil, http.StatusOK, nil
+	}
+
+	err = server.StandardJSONRequestHandler(&validatedInput{}, 0, logicFunc, recorder, req, func(error, *http.Request) {})
+	assert(t, err != nil, "Should return the validation error")
+	assert(t, !logicCalled, "Should not call logic if validation fails")
+
+	equals(t, http.StatusUnprocessableEntity, recorder.Code)
+	problem := readProblem(t, recorder)
+	equals(t, "validation_failed", problem["code"])
+	fields := problem["fields"].([]interface{})
+	equals(t, 4, len(fields))
+	equals(t, "items[1].id", fields[3].(map[string]interface{})["field"])
+	equals(t, "must be a valid UUID", fields[3].(map[string]interface{})["message"])
+}
@@ -0,0 +1,151 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+/*********************************************
+ * In Memory Exporter
+ *
+ * Keeps every span so tests can assert on them
+ * *******************************************/
+
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpan(span SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+// Returns the exported spans in the order they ended
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData{}, e.spans...)
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+/*********************************************
+ * OTLP JSON Exporter
+ *
+ * Writes each span as one line of OTLP/JSON (the same format as the OpenTelemetry Collector's file exporter)
+ * so the output can be shipped by a log collector or read by the collector's otlpjsonfile receiver
+ * *******************************************/
+
+const instrumentationScope = "github.com/Gamma169/go-server-helpers/tracing"
+
+type OTLPJSONExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewOTLPJSONExporter(w io.Writer) *OTLPJSONExporter {
+	return &OTLPJSONExporter{w: w}
+}
+
+// Writes OTLP/JSON lines to stdout
+func NewStdoutExporter() *OTLPJSONExporter {
+	return NewOTLPJSONExporter(os.Stdout)
+}
+
+func (e *OTLPJSONExporter) ExportSpan(span SpanData) error {
+	line, err := json.Marshal(otlpPayload(span))
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(line, '\n'))
+	return err
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func otlpAttributes(attributes map[string]interface{}) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attributes))
+	for key, value := range attributes {
+		kvs = append(kvs, otlpKeyValue{Key: key, Value: otlpValue(value)})
+	}
+	return kvs
+}
+
+// OTLP/JSON encodes 64 bit ints as strings
+func otlpValue(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int:
+		return map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	}
+	return map[string]interface{}{"stringValue": fmt.Sprint(value)}
+}
+
+func otlpPayload(span SpanData) map[string]interface{} {
+	otlpSpan := map[string]interface{}{
+		"traceId":           span.SpanContext.TraceID.String(),
+		"spanId":            span.SpanContext.SpanID.String(),
+		"name":              span.Name,
+		"kind":              int(span.Kind),
+		"startTimeUnixNano": strconv.FormatInt(span.StartTime.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+		"attributes":        otlpAttributes(span.Attributes),
+		"status":            map[string]interface{}{"code": int(span.Status), "message": span.StatusMessage},
+	}
+	if span.ParentSpanID.IsValid() {
+		otlpSpan["parentSpanId"] = span.ParentSpanID.String()
+	}
+	if span.SpanContext.TraceState != "" {
+		otlpSpan["traceState"] = span.SpanContext.TraceState
+	}
+	if len(span.Events) > 0 {
+		events := make([]map[string]interface{}, len(span.Events))
+		for i, event := range span.Events {
+			events[i] = map[string]interface{}{
+				"name":         event.Name,
+				"timeUnixNano": strconv.FormatInt(event.Time.UnixNano(), 10),
+				"attributes":   otlpAttributes(event.Attributes),
+			}
+		}
+		otlpSpan["events"] = events
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": span.ServiceName}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": instrumentationScope},
+				"spans": []interface{}{otlpSpan},
+			}},
+		}},
+	}
+}
@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context headers-- https://www.w3.org/TR/trace-context/
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+const FlagsSampled byte = 0x01
+
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) IsValid() bool  { return t != TraceID{} }
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) IsValid() bool   { return s != SpanID{} }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+func newTraceID() (t TraceID) {
+	// crypto/rand never fails on supported platforms
+	_, _ = rand.Read(t[:])
+	return
+}
+
+func newSpanID() (s SpanID) {
+	_, _ = rand.Read(s[:])
+	return
+}
+
+// Identifies a span across process boundaries
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+	// True if the span context was extracted from an incoming request
+	Remote bool
+}
+
+func (sc SpanContext) IsValid() bool   { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+func (sc SpanContext) IsSampled() bool { return sc.Flags&FlagsSampled != 0 }
+
+// Formats the span context as a version 00 traceparent header value
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// Parses a traceparent header value (ex: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01)
+// Values with a higher version are accepted as long as they start with the version 00 fields, as the spec requires
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+	value = strings.TrimSpace(value)
+	if len(value) < 55 || (len(value) > 55 && value[55] != '-') {
+		return sc, ErrInvalidTraceparent
+	}
+	parts := strings.Split(value[:55], "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, ErrInvalidTraceparent
+	}
+	for _, part := range parts {
+		// Upper case hex is not allowed
+		if strings.ToLower(part) != part {
+			return sc, ErrInvalidTraceparent
+		}
+	}
+
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(value) != 55) {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	sc.Flags = flags[0]
+
+	if !sc.IsValid() {
+		return sc, ErrInvalidTraceparent
+	}
+	sc.Remote = true
+	return sc, nil
+}
+
+// Stores the span context from the traceparent and tracestate headers in ctx as the remote parent
+// so spans started from the returned context continue the caller's trace
+// Returns ctx unchanged if there is no valid traceparent
+func Extract(ctx context.Context, header http.Header) context.Context {
+	sc, err := ParseTraceparent(header.Get(TraceparentHeader))
+	if err != nil {
+		return ctx
+	}
+	// Multiple tracestate headers are combined as one list
+	sc.TraceState = strings.Join(header.Values(TracestateHeader), ",")
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Sets the traceparent and tracestate headers for the span in ctx (ex: on an outgoing request)
+// Does nothing if there is no span in ctx
+func Inject(ctx context.Context, header http.Header) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	header.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		header.Set(TracestateHeader, sc.TraceState)
+	} else {
+		header.Del(TracestateHeader)
+	}
+}
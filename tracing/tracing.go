@@ -0,0 +1,279 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/Gamma169/go-server-helpers/logging"
+	"sync"
+	"time"
+)
+
+/*********************************************
+ * Tracing
+ *
+ * Spans compatible with OpenTelemetry (same ids, kinds, statuses, and W3C propagation)
+ * without depending on the OpenTelemetry SDK
+ *
+ * Set the default tracer once at startup to export spans:
+ *   tracing.SetDefault(tracing.NewTracer("my-service", tracing.NewStdoutExporter()))
+ *
+ * server.AddTracingMiddleware starts a span for every request, and the connections from
+ * db.InitPostgres and db.InitRedis add child spans for the queries and commands made with the request's context
+ * Start your own spans with:
+ *   ctx, span := tracing.Default().Start(ctx, "send-email", tracing.SpanKindInternal)
+ *   defer span.End()
+ * *******************************************/
+
+// Same values as OTLP
+type SpanKind int
+
+const (
+	SpanKindUnspecified SpanKind = iota
+	SpanKindInternal
+	SpanKindServer
+	SpanKindClient
+	SpanKindProducer
+	SpanKindConsumer
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindInternal:
+		return "internal"
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	case SpanKindProducer:
+		return "producer"
+	case SpanKindConsumer:
+		return "consumer"
+	}
+	return "unspecified"
+}
+
+// Same values as OTLP
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]interface{}
+}
+
+// A finished span as passed to the Exporter
+type SpanData struct {
+	ServiceName   string
+	Name          string
+	Kind          SpanKind
+	SpanContext   SpanContext
+	ParentSpanID  SpanID
+	StartTime     time.Time
+	EndTime       time.Time
+	Attributes    map[string]interface{}
+	Events        []Event
+	Status        StatusCode
+	StatusMessage string
+}
+
+// Receives every sampled span when it ends
+// Called synchronously from Span.End, so exporters that do I/O should be fast or buffer
+type Exporter interface {
+	ExportSpan(SpanData) error
+}
+
+/*********************************************
+ * Tracer
+ * *******************************************/
+
+type Tracer struct {
+	serviceName string
+	exporter    Exporter
+}
+
+// exporter can be nil to propagate trace ids without exporting the spans
+func NewTracer(serviceName string, exporter Exporter) *Tracer {
+	return &Tracer{serviceName: serviceName, exporter: exporter}
+}
+
+// Starts a span that is a child of the span (or remote span context) in ctx, or a new trace if there is none
+// The returned context contains the new span
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+
+	sc := SpanContext{SpanID: newSpanID(), Flags: FlagsSampled}
+	if parent.TraceID.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+	} else {
+		sc.TraceID = newTraceID()
+	}
+
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			ServiceName:  t.serviceName,
+			Name:         name,
+			Kind:         kind,
+			SpanContext:  sc,
+			ParentSpanID: parent.SpanID,
+			StartTime:    time.Now(),
+			Attributes:   map[string]interface{}{},
+		},
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+/*********************************************
+ * Span
+ * *******************************************/
+
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+// Changes the name (ex: once the route is known)
+func (s *Span) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.data.Name = name
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.data.Attributes[key] = value
+}
+
+func (s *Span) SetStatus(code StatusCode, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.data.Status = code
+	s.data.StatusMessage = message
+}
+
+// Adds an exception event and marks the span as failed
+// Does nothing if err is nil
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.data.Events = append(s.data.Events, Event{
+		Name: "exception",
+		Time: time.Now(),
+		Attributes: map[string]interface{}{
+			"exception.type":    fmt.Sprintf("%T", err),
+			"exception.message": err.Error(),
+		},
+	})
+	s.data.Status = StatusError
+	s.data.StatusMessage = err.Error()
+}
+
+// Finishes the span and exports it
+// Calling End more than once, or changing the span after it ends, does nothing
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.tracer.exporter == nil || !data.SpanContext.IsSampled() {
+		return
+	}
+	if err := s.tracer.exporter.ExportSpan(data); err != nil {
+		logging.Default().Warn("Could not export span", logging.Fields{logging.FieldTraceId: data.SpanContext.TraceID.String(), logging.FieldError: err})
+	}
+}
+
+/*********************************************
+ * Context
+ * *******************************************/
+
+type contextKey int
+
+const (
+	spanContextKey contextKey = iota
+	remoteSpanContextKey
+)
+
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey, span)
+}
+
+// Returns nil if there is no span in ctx
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey).(*Span)
+	return span
+}
+
+// Used by Extract-- the next span started from ctx becomes a child of sc
+// sc can have only a TraceID (ex: from a legacy trace header) to continue the trace without a parent span
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteSpanContextKey, sc)
+}
+
+// Returns the span context of the span in ctx, or the remote span context if there is no span
+// Returns an invalid (zero) SpanContext if there is neither
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext()
+	}
+	sc, _ := ctx.Value(remoteSpanContextKey).(SpanContext)
+	return sc
+}
+
+/*********************************************
+ * Default Tracer
+ *
+ * All the spans in this library are started with the default tracer
+ * It does not export anything until one is set with SetDefault
+ * *******************************************/
+
+var defaultMu sync.RWMutex
+var defaultTracer = NewTracer("", nil)
+
+func Default() *Tracer {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultTracer
+}
+
+func SetDefault(t *Tracer) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultTracer = t
+}